@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Live safety rules, attacks are aborted once the target is overloaded
+
+var abortMinRequests = 10                       // too few samples are not judged
+var abortCheckInterval = 250 * time.Millisecond // rules are evaluated at most once per interval
+var abortMaxWindow uint = 300                   // each second of the window keeps a histogram
+
+type AbortRules struct {
+	// evaluated over a sliding window during attack, zero value disables the rule
+	MaxErrorRatio float64 // max error ratio in percent
+	MaxP99Latency float64 // max p99 latency in milliseconds
+	Window        uint    // window in seconds up to abortMaxWindow, 5 when unset
+}
+
+func (a AbortRules) IsEmpty() bool {
+	return a.MaxErrorRatio == 0 && a.MaxP99Latency == 0
+}
+
+func (a AbortRules) Validate(errs FieldErrors) {
+	if a.MaxP99Latency < 0 {
+		errs.Add("AbortRules", "abort rules must not be negative")
+	}
+	if a.MaxErrorRatio < 0 || a.MaxErrorRatio > 100 {
+		errs.Add("AbortRules", "abort error ratio must be between 0 and 100")
+	}
+	if a.Window > abortMaxWindow {
+		errs.Add("AbortRules", fmt.Sprintf("abort window must be between 1 and %d seconds", abortMaxWindow))
+	}
+}
+
+type abortBucket struct {
+	// results finished in one second
+	second    int64
+	requests  int
+	errors    int
+	latencies *Histogram
+}
+
+type CircuitBreaker struct {
+	// shared by attacking workers, onTrip is called once when a rule fires
+	rules     AbortRules
+	onTrip    func()
+	buckets   []abortBucket
+	window    *Histogram // latencies of the window merged for checking
+	checkedAt time.Time
+	reason    string
+	mutex     sync.Mutex
+}
+
+func NewCircuitBreaker(rules AbortRules, onTrip func()) *CircuitBreaker {
+	// nil breaker for empty rules
+	if rules.IsEmpty() {
+		return nil
+	}
+	if rules.Window == 0 {
+		rules.Window = 5
+	}
+	if rules.Window > abortMaxWindow {
+		// agents run jobs they did not validate
+		rules.Window = abortMaxWindow
+	}
+	var breaker = &CircuitBreaker{rules: rules, onTrip: onTrip, buckets: make([]abortBucket, rules.Window), window: NewHistogram()}
+	for i := range breaker.buckets {
+		breaker.buckets[i].latencies = NewHistogram()
+	}
+	return breaker
+}
+
+func (b *CircuitBreaker) Record(at time.Time, latency time.Duration, failed bool) {
+	b.mutex.Lock()
+	if b.reason != "" {
+		b.mutex.Unlock()
+		return
+	}
+	var second = at.Unix()
+	var bucket = &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		bucket.second, bucket.requests, bucket.errors = second, 0, 0
+		bucket.latencies.Reset()
+	}
+	bucket.requests++
+	if failed {
+		bucket.errors++
+	}
+	bucket.latencies.Record(latency)
+	var tripped = false
+	if at.Sub(b.checkedAt) >= abortCheckInterval {
+		b.checkedAt = at
+		b.reason = b.check(second)
+		tripped = b.reason != ""
+	}
+	b.mutex.Unlock()
+	if tripped && b.onTrip != nil {
+		b.onTrip()
+	}
+}
+
+func (b *CircuitBreaker) check(second int64) string {
+	// judge results of the window ending at second
+	var requests, errors = 0, 0
+	b.window.Reset()
+	for _, bucket := range b.buckets {
+		if bucket.second > second-int64(len(b.buckets)) && bucket.second <= second {
+			requests += bucket.requests
+			errors += bucket.errors
+			b.window.Merge(bucket.latencies)
+		}
+	}
+	if requests < abortMinRequests {
+		return ""
+	}
+	var ratio = float64(errors) * 100 / float64(requests)
+	if b.rules.MaxErrorRatio > 0 && ratio > b.rules.MaxErrorRatio {
+		return fmt.Sprintf("error ratio %.2f%% > %.2f%% over %ds", ratio, b.rules.MaxErrorRatio, len(b.buckets))
+	}
+	if b.rules.MaxP99Latency > 0 {
+		var p99 = b.window.Quantile(0.99).Seconds() * 1000
+		if p99 > b.rules.MaxP99Latency {
+			return fmt.Sprintf("p99 latency %.2fms > %.2fms over %ds", p99, b.rules.MaxP99Latency, len(b.buckets))
+		}
+	}
+	return ""
+}
+
+func (b *CircuitBreaker) Reason() string {
+	// rule fired, empty when not tripped
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.reason
+}
+
+func ParseAbortRulesForm(req *http.Request) AbortRules {
+	// read abort rules from job edit form, empty inputs disable the rule
+	var a AbortRules
+	a.MaxErrorRatio, _ = strconv.ParseFloat(req.FormValue("abort_error_ratio"), 64)
+	a.MaxP99Latency, _ = strconv.ParseFloat(req.FormValue("abort_p99_latency"), 64)
+	var window, _ = strconv.Atoi(req.FormValue("abort_window"))
+	if window < 0 || window > int(abortMaxWindow) {
+		// out of range windows are reported by Validate
+		a.Window = abortMaxWindow + 1
+	} else if window > 0 {
+		a.Window = uint(window)
+	}
+	return a
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_CircuitBreaker(t *testing.T) {
+	if NewCircuitBreaker(AbortRules{Window: 3}, nil) != nil {
+		t.Errorf("empty rules should give nil breaker")
+	}
+	var trips = 0
+	var breaker = NewCircuitBreaker(AbortRules{MaxErrorRatio: 20}, func() { trips++ })
+	var now = time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		breaker.Record(now, time.Millisecond, true)
+	}
+	if breaker.Reason() != "" {
+		t.Errorf("too few requests should not trip, got %s", breaker.Reason())
+	}
+	for i := 0; i < 40; i++ {
+		breaker.Record(now.Add(time.Duration(i)*10*time.Millisecond), time.Millisecond, false)
+	}
+	if breaker.Reason() != "" {
+		t.Errorf("error ratio within rule should not trip, got %s", breaker.Reason())
+	}
+	// errors of earlier seconds slide out of the window
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 20; i++ {
+		breaker.Record(now.Add(time.Duration(i)*20*time.Millisecond), time.Millisecond, i%2 == 0)
+	}
+	if !strings.HasPrefix(breaker.Reason(), "error ratio 50.00% > 20.00%") || trips != 1 {
+		t.Errorf("error ratio over rule should trip once, got %q %d", breaker.Reason(), trips)
+	}
+	breaker.Record(now.Add(time.Second), time.Millisecond, true)
+	if trips != 1 {
+		t.Errorf("tripped breaker should not trip again, got %d", trips)
+	}
+
+	breaker = NewCircuitBreaker(AbortRules{MaxP99Latency: 100, Window: 2}, nil)
+	for i := 0; i < 20; i++ {
+		breaker.Record(now.Add(time.Duration(i)*20*time.Millisecond), 200*time.Millisecond, false)
+	}
+	if !strings.HasPrefix(breaker.Reason(), "p99 latency 200.00ms > 100.00ms over 2s") {
+		t.Errorf("slow responses should trip p99 rule, got %q", breaker.Reason())
+	}
+}
+
+func Test_AbortRulesValidate(t *testing.T) {
+	var errs = FieldErrors{}
+	AbortRules{MaxErrorRatio: 120}.Validate(errs)
+	AbortRules{MaxP99Latency: -1}.Validate(errs)
+	if len(errs["AbortRules"]) == 0 {
+		t.Errorf("invalid abort rules should be reported")
+	}
+	errs = FieldErrors{}
+	AbortRules{MaxErrorRatio: 20, Window: 1000000000}.Validate(errs)
+	if len(errs["AbortRules"]) == 0 {
+		t.Errorf("huge abort window should be rejected")
+	}
+	if breaker := NewCircuitBreaker(AbortRules{MaxErrorRatio: 20, Window: 1000000000}, nil); len(breaker.buckets) != int(abortMaxWindow) {
+		t.Errorf("unvalidated window should be bounded, got %d", len(breaker.buckets))
+	}
+	var req, _ = http.NewRequest("POST", "/", strings.NewReader("abort_error_ratio=20&abort_window=-5"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	errs = FieldErrors{}
+	ParseAbortRulesForm(req).Validate(errs)
+	if len(errs["AbortRules"]) == 0 {
+		t.Errorf("negative form window should be rejected")
+	}
+}
+
+func Test_AbortJobOnErrors(t *testing.T) {
+	var h = setupTestServer()
+	var target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer target.Close()
+	var host = strings.TrimPrefix(target.URL, "http://")
+	var rules = AbortRules{MaxErrorRatio: 20, Window: 1}
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/vegeta/create", url.Values{"name": {"abort"}}))
+	G_Store.UpdateVegetaJob(jobId, map[string]interface{}{"hosts": []string{host}, "method": "GET", "url": "/ping", "abortrules": rules})
+	var start = time.Now()
+	doRequest(h, "POST", "/vegeta/run", url.Values{
+		"job_id":   {jobId},
+		"workers":  {"2"},
+		"timeout":  {"5"},
+		"rate":     {"50", "50"},
+		"duration": {"10", "10"},
+	})
+	waitJobDone(t, G_RunningVegetaJobs, jobId)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("vegeta attack should be aborted early, took %v", elapsed)
+	}
+	vegetaLogs, _ := G_Store.FindVegetaLogs(LogCondition{JobId: jobId}, 0, 0)
+	if len(vegetaLogs) != 1 || vegetaLogs[0].State != "Aborted" || len(vegetaLogs[0].MetricsList) != 1 ||
+		!strings.HasPrefix(vegetaLogs[0].AbortReason, "error ratio") {
+		t.Errorf("vegeta log should be aborted by error ratio, got %v", vegetaLogs)
+	}
+
+	jobId = createdJobId(t, doRequest(h, "POST", "/boom/create", url.Values{"name": {"abort"}}))
+	// boom counts unexpected statuses as errors by assertions only
+	G_Store.UpdateBoomJob(jobId, map[string]interface{}{"hosts": []string{host}, "method": "GET", "url": "/ping", "abortrules": rules,
+		"assertions": Assertions{StatusCodes: []int{200}}})
+	start = time.Now()
+	doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2", "2"},
+		"duration":    {"10", "10"},
+	})
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("boom attack should be aborted early, took %v", elapsed)
+	}
+	boomLogs, _ := G_Store.FindBoomLogs(LogCondition{JobId: jobId}, 0, 0)
+	if len(boomLogs) != 1 || boomLogs[0].State != "Aborted" || len(boomLogs[0].MetricsList) != 1 ||
+		!strings.HasPrefix(boomLogs[0].AbortReason, "error ratio") {
+		t.Errorf("boom log should be aborted by error ratio, got %v", boomLogs)
+	}
+	if w := doRequest(h, "GET", "/boom/metrics", url.Values{"log_id": {boomLogs[0].Id.Hex()}}); !strings.Contains(w.Body.String(), "error ratio") {
+		t.Errorf("metrics page should show abort reason")
+	}
+}
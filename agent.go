@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+// Agent process generating load for a master, see distributed.go for the master side
+
+var agentHeartbeat = 2 * time.Second // interval of registering with the master
+
+func init() {
+	G_Commands["agent"] = AgentCommand
+}
+
+type AgentPeriodCommand struct {
+	// one period of an attack sent by the master, Rate or Concurrency is the share of this agent
+	TaskId      string
+	Period      int
+	Engine      string
+	VegetaJob   *VegetaJob
+	BoomJob     *BoomJob
+	Rate        uint64
+	Concurrency int
+	Duration    uint
+	StartAt     time.Time // in the clock of this agent
+}
+
+type AgentPeriodResult struct {
+	// results of one agent for one period, Error is set when the agent failed or refused the job
+	Agent       string
+	Vegeta      *vegeta.Metrics
+	Boom        *Report
+	Successes   int
+	Latencies   *HistogramSnapshot
+	Series      TimeSeries
+	AbortReason string
+	Error       string
+	StartedAt   time.Time // in the clock of this agent, zero when not started
+}
+
+type AgentClock struct {
+	// reading of the agent clock for measuring its offset to the master
+	Now time.Time
+}
+
+type Agent struct {
+	// running periods by task id, stopped tasks refuse later periods until they finish
+	cancels *CancelMap
+	stopped *ConcurrentSet
+	token   string // shared with the master
+	now     func() time.Time
+}
+
+func NewAgent(token string) *Agent {
+	return &Agent{cancels: NewCancelMap(), stopped: NewConcurrentSet(), token: token, now: time.Now}
+}
+
+func (a *Agent) Handler() http.Handler {
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/agent/period", a.servePeriod)
+	mux.HandleFunc("/agent/stop", a.serveStop)
+	mux.HandleFunc("/agent/finish", a.serveFinish)
+	mux.HandleFunc("/agent/clock", a.serveClock)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// anyone reaching the agent could attack any target with it
+		if !validAgentToken(a.token, req.Header.Get(agentTokenHeader)) {
+			http.Error(w, "agent token is not valid", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, req)
+	})
+}
+
+func (a *Agent) servePeriod(w http.ResponseWriter, req *http.Request) {
+	var command AgentPeriodCommand
+	if err := json.NewDecoder(req.Body).Decode(&command); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (command.Engine == "vegeta" && command.VegetaJob == nil) || (command.Engine == "boom" && command.BoomJob == nil) {
+		http.Error(w, "job of the engine is required", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.RunPeriod(&command))
+}
+
+func (a *Agent) serveStop(w http.ResponseWriter, req *http.Request) {
+	var taskId = req.FormValue("task_id")
+	a.stopped.Put(taskId)
+	a.cancels.Cancel(taskId)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *Agent) serveFinish(w http.ResponseWriter, req *http.Request) {
+	// the master sends no more periods of the task
+	a.stopped.Delete(req.FormValue("task_id"))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *Agent) serveClock(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&AgentClock{Now: a.now()})
+}
+
+func (a *Agent) RunPeriod(command *AgentPeriodCommand) *AgentPeriodResult {
+	// wait for the scheduled start, then attack with the share of this agent
+	var result = &AgentPeriodResult{Latencies: NewHistogram().Snapshot()}
+	if a.stopped.Exists(command.TaskId) {
+		return result
+	}
+	var assertions Assertions
+	if command.Engine == "vegeta" {
+		assertions = command.VegetaJob.Assertions
+	} else if command.Engine == "boom" {
+		assertions = command.BoomJob.Assertions
+	}
+	checker, err := NewResponseChecker(assertions)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.cancels.Put(command.TaskId, cancel)
+	defer a.cancels.Delete(command.TaskId)
+	select {
+	case <-time.After(command.StartAt.Sub(a.now())):
+	case <-ctx.Done():
+		return result
+	}
+	result.StartedAt = a.now()
+	if command.Engine == "vegeta" && command.Rate > 0 {
+		a.runVegeta(ctx, command, checker, result)
+	} else if command.Engine == "boom" && command.Concurrency > 0 {
+		a.runBoom(ctx, command, checker, result)
+	}
+	return result
+}
+
+func (a *Agent) runVegeta(ctx context.Context, command *AgentPeriodCommand, checker *ResponseChecker, result *AgentPeriodResult) {
+	var job = command.VegetaJob
+	attacker := vegeta.NewAttacker(
+		vegeta.Timeout(time.Duration(job.Timeout)*time.Second),
+		vegeta.Workers(job.Workers),
+		vegeta.KeepAlive(job.Keepalive),
+		vegeta.Redirects(job.Redirects))
+	breaker := NewCircuitBreaker(job.AbortRules, attacker.Stop)
+	series := NewTimeSeriesCollector(time.Now())
+	go func() {
+		<-ctx.Done()
+		attacker.Stop()
+	}()
+	var metrics vegeta.Metrics
+	var histogram = NewHistogram()
+	var passed = 0
+	for res := range attacker.Attack(NewRandomVegetaTargeter(job), command.Rate, time.Duration(command.Duration)*time.Second) {
+		if checker != nil && CheckVegetaResult(checker, res) {
+			passed++
+		}
+		if breaker != nil {
+			breaker.Record(res.Timestamp.Add(res.Latency), res.Latency, res.Error != "")
+		}
+		histogram.Record(res.Latency)
+		series.Record(res.Timestamp.Add(res.Latency), command.Period, res.Latency, int(res.Code), res.Error == "")
+		metrics.Add(res)
+	}
+	metrics.Close()
+	if checker != nil && metrics.Requests > 0 {
+		metrics.Success = float64(passed) / float64(metrics.Requests)
+	}
+	result.Vegeta = &metrics
+	result.Successes = int(metrics.Requests) - VegetaErrorCount(&metrics)
+	result.Latencies = histogram.Snapshot()
+	result.Series = series.Close()
+	if breaker != nil {
+		result.AbortReason = breaker.Reason()
+	}
+}
+
+func (a *Agent) runBoom(ctx context.Context, command *AgentPeriodCommand, checker *ResponseChecker, result *AgentPeriodResult) {
+	var job = command.BoomJob
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	breaker := NewCircuitBreaker(job.AbortRules, cancel)
+	series := NewTimeSeriesCollector(time.Now())
+	var boomer = Boomer{
+		Shooter:            NewRandomBoomShooter(job),
+		Duration:           time.Duration(command.Duration) * time.Second,
+		Concurrency:        command.Concurrency,
+		Period:             command.Period,
+		Timeout:            job.Timeout,
+		DisableCompression: job.DisableCompression,
+		DisableKeepAlive:   job.DisableKeepAlive,
+		Checker:            checker,
+		Breaker:            breaker,
+		Series:             series,
+	}
+	var report = boomer.Run(ctx)
+	for _, stats := range report.workers {
+		result.Successes += stats.success
+	}
+	result.Boom = report
+	result.Latencies = report.latencies.Snapshot()
+	result.Series = series.Close()
+	if breaker != nil {
+		result.AbortReason = breaker.Reason()
+	}
+}
+
+func RegisterAgent(client *ApiClient, token string, name string, address string) error {
+	client.Header.Set(agentTokenHeader, token)
+	return client.Call("POST", "/agents", &AgentInfo{Name: name, Address: address}, nil)
+}
+
+func AgentCommand(args []string) int {
+	var fs = flag.NewFlagSet("agent", flag.ContinueOnError)
+	var master = fs.String("master", defaultServer(), "alex master address")
+	var listen = fs.String("listen", "127.0.0.1:9000", "address serving the master")
+	var advertise = fs.String("advertise", "", "address the master dials, listen address by default")
+	var name = fs.String("name", "", "agent name, host name by default")
+	var token = fs.String("token", os.Getenv("ALEX_AGENT_TOKEN"), "AgentToken of the master, ALEX_AGENT_TOKEN by default")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitError
+	}
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "agent token is required")
+		return ExitError
+	}
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	if *advertise == "" {
+		*advertise = listener.Addr().String()
+	}
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+	var agent = NewAgent(*token)
+	var client = NewApiClient(*master)
+	go func() {
+		// registering again keeps the agent alive on the master
+		for {
+			if err := RegisterAgent(client, *token, *name, *advertise); err != nil {
+				fmt.Fprintf(os.Stderr, "register with %s fail: %v\n", *master, err)
+			}
+			time.Sleep(agentHeartbeat)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "agent %s serving %s for master %s\n", *name, *advertise, *master)
+	if err := http.Serve(listener, agent.Handler()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	return ExitOk
+}
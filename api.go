@@ -10,7 +10,6 @@ import (
 	"github.com/martini-contrib/render"
 	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/mem"
-	"gopkg.in/mgo.v2/bson"
 )
 
 func GetSystemStatus(req *http.Request, r render.Render) {
@@ -32,8 +31,7 @@ func GetSystemStatus(req *http.Request, r render.Render) {
 
 func GetVegetaJobState(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
-	var job VegetaJob
-	err := G_MongoDB.C("vegeta_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetVegetaJob(jobId)
 	var result = map[string]interface{}{}
 	if err != nil {
 		result["is_running"] = false
@@ -47,8 +45,7 @@ func GetVegetaJobState(req *http.Request, r render.Render) {
 
 func GetBoomJobState(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
-	var job BoomJob
-	err := G_MongoDB.C("boom_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetBoomJob(jobId)
 	var result = map[string]interface{}{}
 	if err != nil {
 		result["is_running"] = false
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Versioned JSON API for driving benchmarks programmatically
+
+type VegetaJobView struct {
+	*VegetaJob
+	Running bool
+}
+
+type BoomJobView struct {
+	*BoomJob
+	Running bool
+}
+
+type VegetaRunSettings struct {
+	// request body of running vegeta job, omitted fields keep job settings
+	Workers     uint64
+	Timeout     int
+	Redirects   int
+	Keepalive   bool
+	Periods     []RatePeriod
+	Search      *CapacitySearch
+	Distributed bool
+	Comment     string
+}
+
+type BoomRunSettings struct {
+	// request body of running boom job, omitted fields keep job settings
+	Timeout            int
+	DisableKeepAlive   bool
+	DisableCompression bool
+	Periods            []ConcurrencyPeriod
+	Distributed        bool
+	Comment            string
+}
+
+func apiError(r render.Render, status int, message string, fields FieldErrors) {
+	var result = map[string]interface{}{"error": message}
+	if len(fields) > 0 {
+		result["fields"] = fields
+	}
+	r.JSON(status, result)
+}
+
+func apiStoreError(r render.Render, err error) {
+	if err == ErrNotFound {
+		apiError(r, http.StatusNotFound, err.Error(), nil)
+	} else {
+		apiError(r, http.StatusInternalServerError, err.Error(), nil)
+	}
+}
+
+func decodeJsonBody(req *http.Request, v interface{}) error {
+	err := json.NewDecoder(req.Body).Decode(v)
+	if err == io.EOF {
+		// empty body keeps defaults
+		return nil
+	}
+	return err
+}
+
+func apiPager(req *http.Request, total int) *Pager {
+	var pager = NewPager(20, total)
+	pager.CurrentPage, _ = strconv.Atoi(req.FormValue("p"))
+	return pager
+}
+
+func ApiGetVegetaJobs(req *http.Request, r render.Render) {
+	var condition = JobCondition{req.FormValue("team"), req.FormValue("project"), req.FormValue("url")}
+	total, err := G_Store.CountVegetaJobs(condition)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var pager = apiPager(req, total)
+	jobs, err := G_Store.FindVegetaJobs(condition, pager.Offset(), pager.Limit())
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var views = []VegetaJobView{}
+	for i := range jobs {
+		views = append(views, VegetaJobView{&jobs[i], jobs[i].IsRunning()})
+	}
+	r.JSON(200, map[string]interface{}{"total": total, "page": pager.CurrentPage, "page_size": pager.PageSize, "jobs": views})
+}
+
+func ApiCreateVegetaJob(req *http.Request, r render.Render) {
+	var job = NewVegetaJob("", "", "")
+	err := decodeJsonBody(req, job)
+	if err != nil {
+		apiError(r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	// server side fields can not be assigned
+	job.Id = bson.NewObjectId()
+	job.CurrentRate = 0
+	if errs := job.Validate(); len(errs) > 0 {
+		apiError(r, http.StatusUnprocessableEntity, "invalid job settings", errs)
+		return
+	}
+	err = G_Store.InsertVegetaJob(job)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Header().Set("Location", "/api/v1/vegeta/jobs/"+job.Id.Hex())
+	r.JSON(http.StatusCreated, VegetaJobView{job, false})
+}
+
+func ApiGetVegetaJob(params martini.Params, r render.Render) {
+	job, err := G_Store.GetVegetaJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.JSON(200, VegetaJobView{job, job.IsRunning()})
+}
+
+func ApiUpdateVegetaJob(params martini.Params, req *http.Request, r render.Render) {
+	job, err := G_Store.GetVegetaJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var stored = *job
+	err = decodeJsonBody(req, job)
+	if err != nil {
+		apiError(r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	job.Id = stored.Id
+	job.CreateTs = stored.CreateTs
+	job.LastRunTs = stored.LastRunTs
+	job.CurrentRate = stored.CurrentRate
+	// baseline is pinned and regression judged by the server
+	job.BaselineLogId = stored.BaselineLogId
+	job.LastRegression = stored.LastRegression
+	if errs := job.Validate(); len(errs) > 0 {
+		apiError(r, http.StatusUnprocessableEntity, "invalid job settings", errs)
+		return
+	}
+	err = SaveVegetaJob(job)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	job, err = G_Store.GetVegetaJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.JSON(200, VegetaJobView{job, job.IsRunning()})
+}
+
+func ApiDeleteVegetaJob(params martini.Params, r render.Render) {
+	var jobId = params["id"]
+	if G_RunningVegetaJobs.Exists(jobId) {
+		apiError(r, http.StatusConflict, ErrJobRunning.Error(), nil)
+		return
+	}
+	G_Exporter.Forget("vegeta", jobId)
+	err := G_Store.RemoveVegetaJob(jobId)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Status(http.StatusNoContent)
+}
+
+func ApiRunVegetaJob(params martini.Params, req *http.Request, r render.Render) {
+	job, err := G_Store.GetVegetaJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var settings = VegetaRunSettings{
+		Workers:     job.Workers,
+		Timeout:     job.Timeout,
+		Redirects:   job.Redirects,
+		Keepalive:   job.Keepalive,
+		Periods:     job.Periods,
+		Search:      job.Search,
+		Distributed: job.Distributed,
+	}
+	err = decodeJsonBody(req, &settings)
+	if err != nil {
+		apiError(r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	job.Workers = settings.Workers
+	job.Timeout = settings.Timeout
+	job.Redirects = settings.Redirects
+	job.Keepalive = settings.Keepalive
+	job.Periods = settings.Periods
+	job.Search = settings.Search
+	job.Distributed = settings.Distributed
+	if errs := job.ValidateRun(); len(errs) > 0 {
+		apiError(r, http.StatusUnprocessableEntity, "job is not runnable", errs)
+		return
+	}
+	lg, err := StartVegetaJob(job, settings.Comment)
+	if err == ErrJobRunning || err == ErrNoAgents {
+		apiError(r, http.StatusConflict, err.Error(), nil)
+		return
+	} else if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Header().Set("Location", "/api/v1/vegeta/logs/"+lg.Id.Hex())
+	r.JSON(http.StatusAccepted, lg)
+}
+
+func ApiStopVegetaJob(params martini.Params, r render.Render) {
+	var jobId = params["id"]
+	if !G_RunningVegetaJobs.Exists(jobId) {
+		apiError(r, http.StatusConflict, "job is not running", nil)
+		return
+	}
+	StopVegetaAttack(jobId)
+	r.JSON(http.StatusAccepted, map[string]interface{}{"id": jobId, "stopping": true})
+}
+
+func ApiGetVegetaLogs(req *http.Request, r render.Render) {
+	var condition = LogCondition{JobId: req.FormValue("job_id")}
+	total, err := G_Store.CountVegetaLogs(condition)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var pager = apiPager(req, total)
+	logs, err := G_Store.FindVegetaLogs(condition, pager.Offset(), pager.Limit())
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	if logs == nil {
+		logs = []AttackVegetaLog{}
+	}
+	r.JSON(200, map[string]interface{}{"total": total, "page": pager.CurrentPage, "page_size": pager.PageSize, "logs": logs})
+}
+
+func ApiGetVegetaLog(params martini.Params, r render.Render) {
+	lg, err := G_Store.GetVegetaLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.JSON(200, lg)
+}
+
+func ApiDeleteVegetaLog(params martini.Params, r render.Render) {
+	lg, err := G_Store.GetVegetaLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	if lg.IsRunning() {
+		apiError(r, http.StatusConflict, "attack is still running", nil)
+		return
+	}
+	err = G_Store.RemoveVegetaLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Status(http.StatusNoContent)
+}
+
+func ApiPinVegetaLog(params martini.Params, r render.Render) {
+	// pin log as baseline of its job, returns the job
+	lg, err := G_Store.GetVegetaLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	err = PinVegetaBaseline(lg)
+	if err == ErrJobRunning {
+		apiError(r, http.StatusConflict, "attack is still running", nil)
+		return
+	}
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	ApiGetVegetaJob(martini.Params{"id": lg.JobId}, r)
+}
+
+func ApiUnpinVegetaJob(params martini.Params, r render.Render) {
+	if _, err := G_Store.GetVegetaJob(params["id"]); err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	err := UnpinVegetaBaseline(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Status(http.StatusNoContent)
+}
+
+func ApiCompareVegetaLogs(req *http.Request, r render.Render) {
+	// compare logs given by repeated log_id, deltas against the first one
+	req.ParseForm()
+	logs, err := LoadVegetaLogs(req.Form["log_id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	comparison, err := CompareVegetaLogs(logs)
+	if err != nil {
+		apiError(r, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+	r.JSON(200, comparison)
+}
+
+func ApiGetBoomJobs(req *http.Request, r render.Render) {
+	var condition = JobCondition{req.FormValue("team"), req.FormValue("project"), req.FormValue("url")}
+	total, err := G_Store.CountBoomJobs(condition)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var pager = apiPager(req, total)
+	jobs, err := G_Store.FindBoomJobs(condition, pager.Offset(), pager.Limit())
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var views = []BoomJobView{}
+	for i := range jobs {
+		views = append(views, BoomJobView{&jobs[i], jobs[i].IsRunning()})
+	}
+	r.JSON(200, map[string]interface{}{"total": total, "page": pager.CurrentPage, "page_size": pager.PageSize, "jobs": views})
+}
+
+func ApiCreateBoomJob(req *http.Request, r render.Render) {
+	var job = NewBoomJob("", "", "")
+	err := decodeJsonBody(req, job)
+	if err != nil {
+		apiError(r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	// server side fields can not be assigned
+	job.Id = bson.NewObjectId()
+	job.CurrentConcurrency = 0
+	if errs := job.Validate(); len(errs) > 0 {
+		apiError(r, http.StatusUnprocessableEntity, "invalid job settings", errs)
+		return
+	}
+	err = G_Store.InsertBoomJob(job)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Header().Set("Location", "/api/v1/boom/jobs/"+job.Id.Hex())
+	r.JSON(http.StatusCreated, BoomJobView{job, false})
+}
+
+func ApiGetBoomJob(params martini.Params, r render.Render) {
+	job, err := G_Store.GetBoomJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.JSON(200, BoomJobView{job, job.IsRunning()})
+}
+
+func ApiUpdateBoomJob(params martini.Params, req *http.Request, r render.Render) {
+	job, err := G_Store.GetBoomJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var stored = *job
+	err = decodeJsonBody(req, job)
+	if err != nil {
+		apiError(r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	job.Id = stored.Id
+	job.CreateTs = stored.CreateTs
+	job.LastRunTs = stored.LastRunTs
+	job.CurrentConcurrency = stored.CurrentConcurrency
+	// baseline is pinned and regression judged by the server
+	job.BaselineLogId = stored.BaselineLogId
+	job.LastRegression = stored.LastRegression
+	if errs := job.Validate(); len(errs) > 0 {
+		apiError(r, http.StatusUnprocessableEntity, "invalid job settings", errs)
+		return
+	}
+	err = SaveBoomJob(job)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	job, err = G_Store.GetBoomJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.JSON(200, BoomJobView{job, job.IsRunning()})
+}
+
+func ApiDeleteBoomJob(params martini.Params, r render.Render) {
+	var jobId = params["id"]
+	if G_RunningBoomJobs.Exists(jobId) {
+		apiError(r, http.StatusConflict, ErrJobRunning.Error(), nil)
+		return
+	}
+	G_Exporter.Forget("boom", jobId)
+	err := G_Store.RemoveBoomJob(jobId)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Status(http.StatusNoContent)
+}
+
+func ApiRunBoomJob(params martini.Params, req *http.Request, r render.Render) {
+	job, err := G_Store.GetBoomJob(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var settings = BoomRunSettings{
+		Timeout:            job.Timeout,
+		DisableKeepAlive:   job.DisableKeepAlive,
+		DisableCompression: job.DisableCompression,
+		Periods:            job.Periods,
+		Distributed:        job.Distributed,
+	}
+	err = decodeJsonBody(req, &settings)
+	if err != nil {
+		apiError(r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	job.Timeout = settings.Timeout
+	job.DisableKeepAlive = settings.DisableKeepAlive
+	job.DisableCompression = settings.DisableCompression
+	job.Periods = settings.Periods
+	job.Distributed = settings.Distributed
+	if errs := job.ValidateRun(); len(errs) > 0 {
+		apiError(r, http.StatusUnprocessableEntity, "job is not runnable", errs)
+		return
+	}
+	lg, err := StartBoomJob(job, settings.Comment)
+	if err == ErrJobRunning || err == ErrNoAgents {
+		apiError(r, http.StatusConflict, err.Error(), nil)
+		return
+	} else if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Header().Set("Location", "/api/v1/boom/logs/"+lg.Id.Hex())
+	r.JSON(http.StatusAccepted, lg)
+}
+
+func ApiStopBoomJob(params martini.Params, r render.Render) {
+	var jobId = params["id"]
+	if !G_RunningBoomJobs.Exists(jobId) {
+		apiError(r, http.StatusConflict, "job is not running", nil)
+		return
+	}
+	StopBoomAttack(jobId)
+	r.JSON(http.StatusAccepted, map[string]interface{}{"id": jobId, "stopping": true})
+}
+
+func ApiGetBoomLogs(req *http.Request, r render.Render) {
+	var condition = LogCondition{JobId: req.FormValue("job_id")}
+	total, err := G_Store.CountBoomLogs(condition)
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	var pager = apiPager(req, total)
+	logs, err := G_Store.FindBoomLogs(condition, pager.Offset(), pager.Limit())
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	if logs == nil {
+		logs = []AttackBoomLog{}
+	}
+	r.JSON(200, map[string]interface{}{"total": total, "page": pager.CurrentPage, "page_size": pager.PageSize, "logs": logs})
+}
+
+func ApiGetBoomLog(params martini.Params, r render.Render) {
+	lg, err := G_Store.GetBoomLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.JSON(200, lg)
+}
+
+func ApiDeleteBoomLog(params martini.Params, r render.Render) {
+	lg, err := G_Store.GetBoomLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	if lg.IsRunning() {
+		apiError(r, http.StatusConflict, "attack is still running", nil)
+		return
+	}
+	err = G_Store.RemoveBoomLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Status(http.StatusNoContent)
+}
+
+func ApiPinBoomLog(params martini.Params, r render.Render) {
+	// pin log as baseline of its job, returns the job
+	lg, err := G_Store.GetBoomLog(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	err = PinBoomBaseline(lg)
+	if err == ErrJobRunning {
+		apiError(r, http.StatusConflict, "attack is still running", nil)
+		return
+	}
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	ApiGetBoomJob(martini.Params{"id": lg.JobId}, r)
+}
+
+func ApiUnpinBoomJob(params martini.Params, r render.Render) {
+	if _, err := G_Store.GetBoomJob(params["id"]); err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	err := UnpinBoomBaseline(params["id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	r.Status(http.StatusNoContent)
+}
+
+func ApiCompareBoomLogs(req *http.Request, r render.Render) {
+	// compare logs given by repeated log_id, deltas against the first one
+	req.ParseForm()
+	logs, err := LoadBoomLogs(req.Form["log_id"])
+	if err != nil {
+		apiStoreError(r, err)
+		return
+	}
+	comparison, err := CompareBoomLogs(logs)
+	if err != nil {
+		apiError(r, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+	r.JSON(200, comparison)
+}
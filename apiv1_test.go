@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func doJsonRequest(h http.Handler, method string, path string, body interface{}, result interface{}) int {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	var w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if result != nil {
+		json.Unmarshal(w.Body.Bytes(), result)
+	}
+	return w.Code
+}
+
+func Test_ApiVegetaJob(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var failure struct {
+		Error  string
+		Fields FieldErrors `json:"fields"`
+	}
+	var code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs", map[string]interface{}{"Url": "ping"}, &failure)
+	if code != http.StatusUnprocessableEntity || len(failure.Fields["Name"]) == 0 || len(failure.Fields["Url"]) == 0 {
+		t.Errorf("invalid job should be rejected, got %d %v", code, failure)
+	}
+	if code = doJsonRequest(h, "GET", "/api/v1/vegeta/jobs/unknown", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown job should be 404, got %d", code)
+	}
+
+	var job VegetaJobView
+	code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs", map[string]interface{}{
+		"Name":  "ping",
+		"Team":  "go",
+		"Url":   "/ping",
+		"Hosts": []string{target.Host()},
+	}, &job)
+	if code != http.StatusCreated || job.VegetaJob == nil || job.Workers != 100 || len(job.Seeds) != 1 {
+		t.Fatalf("job should be created with defaults, got %d %v", code, job.VegetaJob)
+	}
+	var jobId = job.Id.Hex()
+	code = doJsonRequest(h, "PUT", "/api/v1/vegeta/jobs/"+jobId, map[string]interface{}{"Project": "alex"}, &job)
+	if code != 200 || job.Project != "alex" || job.Url != "/ping" {
+		t.Errorf("job should be partially updated, got %d %v", code, job.VegetaJob)
+	}
+	code = doJsonRequest(h, "PUT", "/api/v1/vegeta/jobs/"+jobId, map[string]interface{}{
+		"Distributed":    true,
+		"Search":         CapacitySearch{MinRate: 10, MaxRate: 100, Precision: 10, Duration: 1, Slo: Thresholds{MinSuccessRatio: 99}},
+		"LastRegression": Regression{},
+	}, &job)
+	if stored, _ := G_Store.GetVegetaJob(jobId); code != 200 || !stored.Distributed || stored.Search == nil || stored.LastRegression != nil {
+		t.Errorf("editable settings should be stored and server fields kept, got %d %v", code, stored)
+	}
+	if job.LastRegression != nil || !job.Distributed {
+		t.Errorf("response should show the stored job, got %v", job.VegetaJob)
+	}
+	doJsonRequest(h, "PUT", "/api/v1/vegeta/jobs/"+jobId, map[string]interface{}{"Distributed": false, "Search": nil}, nil)
+	var list struct {
+		Total int
+		Jobs  []VegetaJobView
+	}
+	if code = doJsonRequest(h, "GET", "/api/v1/vegeta/jobs?project=alex", nil, &list); code != 200 || list.Total != 1 {
+		t.Errorf("job list should contain the job, got %d %v", code, list)
+	}
+
+	code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs/"+jobId+"/run", map[string]interface{}{"Periods": []RatePeriod{}}, &failure)
+	if code != http.StatusUnprocessableEntity || len(failure.Fields["Periods"]) == 0 {
+		t.Errorf("run without periods should be rejected, got %d %v", code, failure)
+	}
+	var lg AttackVegetaLog
+	code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs/"+jobId+"/run", map[string]interface{}{
+		"Workers": 2,
+		"Periods": []RatePeriod{{Rate: 10, Duration: 1}},
+		"Comment": "api run",
+	}, &lg)
+	if code != http.StatusAccepted || lg.State != "Running" || lg.Comment != "api run" {
+		t.Fatalf("run should be accepted, got %d %v", code, lg)
+	}
+	if code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs/"+jobId+"/run", nil, nil); code != http.StatusConflict {
+		t.Errorf("running job should not run again, got %d", code)
+	}
+	if code = doJsonRequest(h, "DELETE", "/api/v1/vegeta/jobs/"+jobId, nil, nil); code != http.StatusConflict {
+		t.Errorf("running job should not be deleted, got %d", code)
+	}
+	waitJobDone(t, G_RunningVegetaJobs, jobId)
+
+	if code = doJsonRequest(h, "GET", "/api/v1/vegeta/logs/"+lg.Id.Hex(), nil, &lg); code != 200 || lg.State != "End" || len(lg.MetricsList) != 1 {
+		t.Errorf("log should be finished, got %d %v", code, lg)
+	}
+	var logs struct {
+		Total int
+		Logs  []AttackVegetaLog
+	}
+	if code = doJsonRequest(h, "GET", "/api/v1/vegeta/logs?job_id="+jobId, nil, &logs); code != 200 || logs.Total != 1 {
+		t.Errorf("log list should contain the log, got %d %v", code, logs)
+	}
+	if code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs/"+jobId+"/stop", nil, nil); code != http.StatusConflict {
+		t.Errorf("quiet job should not be stopped, got %d", code)
+	}
+	if code = doJsonRequest(h, "DELETE", "/api/v1/vegeta/logs/"+lg.Id.Hex(), nil, nil); code != http.StatusNoContent {
+		t.Errorf("log should be deleted, got %d", code)
+	}
+	if code = doJsonRequest(h, "DELETE", "/api/v1/vegeta/jobs/"+jobId, nil, nil); code != http.StatusNoContent {
+		t.Errorf("job should be deleted, got %d", code)
+	}
+}
+
+func Test_ApiBoomJob(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job BoomJobView
+	var code = doJsonRequest(h, "POST", "/api/v1/boom/jobs", map[string]interface{}{
+		"Name":  "ping",
+		"Url":   "/ping",
+		"Hosts": []string{target.Host()},
+	}, &job)
+	if code != http.StatusCreated || job.BoomJob == nil {
+		t.Fatalf("job should be created, got %d", code)
+	}
+	var jobId = job.Id.Hex()
+	var lg AttackBoomLog
+	code = doJsonRequest(h, "POST", "/api/v1/boom/jobs/"+jobId+"/run", map[string]interface{}{
+		"Periods": []ConcurrencyPeriod{{Concurrency: 2, Duration: 1}},
+	}, &lg)
+	if code != http.StatusAccepted {
+		t.Fatalf("run should be accepted, got %d", code)
+	}
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+	if code = doJsonRequest(h, "GET", "/api/v1/boom/logs/"+lg.Id.Hex(), nil, &lg); code != 200 || lg.State != "End" || lg.MetricsList[0].Requests == 0 {
+		t.Errorf("log should be finished, got %d %v", code, lg)
+	}
+	if code = doJsonRequest(h, "GET", "/api/v1/boom/jobs/"+jobId, nil, &job); code != 200 || job.Running || len(job.Periods) != 1 {
+		t.Errorf("job should keep run settings, got %d %v", code, job.BoomJob)
+	}
+}
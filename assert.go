@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Assertions struct {
+	// response checks, responses breaking any of them are counted as failures
+	StatusCodes  []int  // expected status codes, empty means any status
+	BodyContains string // expected substring of response body
+	BodyRegexp   string // expected pattern of response body
+	JsonPath     string // path of json body field like data.items[0].id
+	JsonValue    string // expected value of the json field, empty only checks the field exists
+}
+
+func (a Assertions) IsEmpty() bool {
+	return len(a.StatusCodes) == 0 && !a.NeedBody()
+}
+
+func (a Assertions) NeedBody() bool {
+	// body checks require reading the whole response
+	return a.BodyContains != "" || a.BodyRegexp != "" || a.JsonPath != ""
+}
+
+func (a Assertions) Validate(errs FieldErrors) {
+	// check assertions along with job settings
+	for _, code := range a.StatusCodes {
+		if code < 100 || code > 599 {
+			errs.Add("Assertions", fmt.Sprintf("invalid status code %d", code))
+		}
+	}
+	if _, err := regexp.Compile(a.BodyRegexp); err != nil {
+		errs.Add("Assertions", "invalid body regexp: "+err.Error())
+	}
+	if a.JsonValue != "" && a.JsonPath == "" {
+		errs.Add("Assertions", "json path is required for json value")
+	}
+	if a.JsonPath != "" && jsonPathKeys(a.JsonPath) == nil {
+		errs.Add("Assertions", "json path must name a field")
+	}
+}
+
+type ResponseChecker struct {
+	// compiled assertions shared by attacking workers
+	assertions Assertions
+	statuses   map[int]bool
+	pattern    *regexp.Regexp
+}
+
+func NewResponseChecker(a Assertions) (*ResponseChecker, error) {
+	// nil checker for empty assertions
+	if a.IsEmpty() {
+		return nil, nil
+	}
+	var checker = &ResponseChecker{assertions: a, statuses: make(map[int]bool)}
+	for _, code := range a.StatusCodes {
+		checker.statuses[code] = true
+	}
+	if a.BodyRegexp != "" {
+		pattern, err := regexp.Compile(a.BodyRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body regexp: %v", err)
+		}
+		checker.pattern = pattern
+	}
+	return checker, nil
+}
+
+func (c *ResponseChecker) NeedBody() bool {
+	return c.assertions.NeedBody()
+}
+
+func (c *ResponseChecker) CheckStatus(code int) error {
+	if len(c.statuses) > 0 && !c.statuses[code] {
+		return fmt.Errorf("unexpected status %d", code)
+	}
+	return nil
+}
+
+func (c *ResponseChecker) Check(code int, body []byte) error {
+	// returns the first broken assertion
+	if err := c.CheckStatus(code); err != nil {
+		return err
+	}
+	if c.assertions.BodyContains != "" && !strings.Contains(string(body), c.assertions.BodyContains) {
+		return fmt.Errorf("body does not contain %q", c.assertions.BodyContains)
+	}
+	if c.pattern != nil && !c.pattern.Match(body) {
+		return fmt.Errorf("body does not match %q", c.assertions.BodyRegexp)
+	}
+	if c.assertions.JsonPath != "" {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("body is not json")
+		}
+		value, ok := JsonPathLookup(doc, c.assertions.JsonPath)
+		if !ok {
+			return fmt.Errorf("json path %s not found", c.assertions.JsonPath)
+		}
+		if text := JsonValueText(value); c.assertions.JsonValue != "" && text != c.assertions.JsonValue {
+			return fmt.Errorf("json path %s is %s, expected %s", c.assertions.JsonPath, text, c.assertions.JsonValue)
+		}
+	}
+	return nil
+}
+
+func jsonPathKeys(path string) []string {
+	// keys and array indexes of a dotted path, leading $ is optional
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.Replace(path, "[", ".", -1)
+	path = strings.Replace(path, "]", "", -1)
+	var keys []string
+	for _, key := range strings.Split(path, ".") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func JsonPathLookup(doc interface{}, path string) (interface{}, bool) {
+	// walk dotted path with array indexes
+	var current = doc
+	for _, key := range jsonPathKeys(path) {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func JsonValueText(value interface{}) string {
+	// strings compare unquoted, other values in json encoding
+	if text, ok := value.(string); ok {
+		return text
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func ParseAssertionsForm(req *http.Request) Assertions {
+	// read assertions from job edit form, status codes separated by comma
+	var a Assertions
+	for _, field := range strings.Split(req.FormValue("status_codes"), ",") {
+		if code, err := strconv.Atoi(strings.TrimSpace(field)); err == nil {
+			a.StatusCodes = append(a.StatusCodes, code)
+		}
+	}
+	a.BodyContains = req.FormValue("body_contains")
+	a.BodyRegexp = req.FormValue("body_regexp")
+	a.JsonPath = req.FormValue("json_path")
+	a.JsonValue = req.FormValue("json_value")
+	return a
+}
+
+func (a Assertions) StatusCodesText() string {
+	// status codes for edit form input
+	var codes []string
+	for _, code := range a.StatusCodes {
+		codes = append(codes, strconv.Itoa(code))
+	}
+	return strings.Join(codes, ",")
+}
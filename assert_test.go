@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_JsonPathLookup(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"data": {"items": [{"id": 7, "name": "alex"}], "ok": true}}`), &doc)
+	var cases = map[string]string{
+		"data.items[0].id":     "7",
+		"$.data.items[0].name": "alex",
+		"data.ok":              "true",
+	}
+	for path, expected := range cases {
+		value, ok := JsonPathLookup(doc, path)
+		if !ok || JsonValueText(value) != expected {
+			t.Errorf("%s should be %s, got %v", path, expected, value)
+		}
+	}
+	for _, path := range []string{"data.items[1].id", "data.missing", "data.ok.value"} {
+		if _, ok := JsonPathLookup(doc, path); ok {
+			t.Errorf("%s should not be found", path)
+		}
+	}
+}
+
+func Test_ResponseChecker(t *testing.T) {
+	if checker, err := NewResponseChecker(Assertions{}); checker != nil || err != nil {
+		t.Errorf("empty assertions should not need a checker")
+	}
+	if _, err := NewResponseChecker(Assertions{BodyRegexp: "("}); err == nil {
+		t.Errorf("invalid regexp should fail the checker")
+	}
+	checker, _ := NewResponseChecker(Assertions{
+		StatusCodes:  []int{200, 201},
+		BodyContains: "alex",
+		BodyRegexp:   `"id":\s*\d+`,
+		JsonPath:     "data.id",
+		JsonValue:    "7",
+	})
+	if err := checker.Check(200, []byte(`{"data": {"id": 7, "name": "alex"}}`)); err != nil {
+		t.Errorf("matching response should pass, got %v", err)
+	}
+	var failures = map[int]string{
+		500: `{"data": {"id": 7, "name": "alex"}}`,
+		200: `{"data": {"id": 8, "name": "alex"}}`,
+		201: `not json alex "id": 7`,
+	}
+	for code, body := range failures {
+		if err := checker.Check(code, []byte(body)); err == nil {
+			t.Errorf("response %d %s should fail", code, body)
+		}
+	}
+	var exists, _ = NewResponseChecker(Assertions{JsonPath: "data.name"})
+	if exists.Check(200, []byte(`{"data": {"name": ""}}`)) != nil || exists.Check(200, []byte(`{"data": {}}`)) == nil {
+		t.Errorf("json path without value should check the field exists")
+	}
+	var errs = FieldErrors{}
+	Assertions{StatusCodes: []int{99}, BodyRegexp: "("}.Validate(errs)
+	if len(errs["Assertions"]) != 2 {
+		t.Errorf("invalid status code and regexp should both be rejected, got %v", errs)
+	}
+	errs = FieldErrors{}
+	Assertions{JsonPath: "$."}.Validate(errs)
+	if len(errs["Assertions"]) == 0 {
+		t.Errorf("json path without field should be rejected")
+	}
+	var job = NewVegetaJob("ping", "", "")
+	job.Assertions.BodyContains = "ok"
+	if errs = job.Validate(); len(errs["Assertions"]) == 0 {
+		t.Errorf("vegeta should reject body assertions")
+	}
+}
+
+func Test_BoomerAssertions(t *testing.T) {
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job = NewBoomJob("ping", "", "")
+	job.Url = "/ping"
+	job.Hosts = []string{target.Host()}
+	checker, _ := NewResponseChecker(Assertions{JsonPath: "ok", JsonValue: "false"})
+	var boomer = Boomer{
+		Shooter:     NewRandomBoomShooter(job),
+		Duration:    200 * time.Millisecond,
+		Concurrency: 2,
+		Timeout:     10,
+		Checker:     checker,
+	}
+	var report = boomer.Run(context.Background())
+	if report.Requests == 0 || report.SuccessRatio != 0 || report.ErrorDist["json path ok is true, expected false"] != report.Requests {
+		t.Errorf("mismatched responses should be counted as errors, got %v", report)
+	}
+	if report.StatusCodeDist["200"] != report.Requests {
+		t.Errorf("failed assertions should keep status codes, got %v", report.StatusCodeDist)
+	}
+}
+
+func Test_VegetaStatusAssertions(t *testing.T) {
+	setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job = NewVegetaJob("ping", "", "")
+	job.Url = "/ping"
+	job.Hosts = []string{target.Host()}
+	job.Workers = 2
+	job.Periods = []RatePeriod{{10, 1}}
+	job.Assertions.StatusCodes = []int{201}
+	G_Store.InsertVegetaJob(job)
+	G_RunningVegetaJobs.Put(job.Id.Hex())
+	var lg = LogAttackVegetaStart(job, "assertions")
+	AttackVegetaJob(job, lg)
+	lg, _ = G_Store.GetVegetaLog(lg.Id.Hex())
+	var metrics = lg.MetricsList[0]
+	if metrics.Requests == 0 || metrics.Success != 0 || len(metrics.Errors) != 1 || metrics.Errors[0] != "unexpected status 200" {
+		t.Errorf("unexpected statuses should fail requests, got %v %v", metrics.Success, metrics.Errors)
+	}
+}
+
+func Test_BrokenAssertionsAbortAttack(t *testing.T) {
+	setupTestServer()
+	var job = NewBoomJob("ping", "", "")
+	job.Assertions.BodyRegexp = "("
+	G_Store.InsertBoomJob(job)
+	G_RunningBoomJobs.Put(job.Id.Hex())
+	var lg = LogAttackBoomStart(job, "broken")
+	AttackBoomJob(job, lg)
+	lg, _ = G_Store.GetBoomLog(lg.Id.Hex())
+	if lg.State != "Aborted" || !strings.Contains(lg.AbortReason, "invalid body regexp") || G_RunningBoomJobs.Exists(job.Id.Hex()) {
+		t.Errorf("broken assertions should abort the attack, got %s %q", lg.State, lg.AbortReason)
+	}
+	var result = NewAgent("").RunPeriod(&AgentPeriodCommand{Engine: "boom", BoomJob: job, Concurrency: 1, Duration: 1})
+	if !strings.Contains(result.Error, "invalid body regexp") || !result.StartedAt.IsZero() {
+		t.Errorf("agent should refuse broken assertions, got %+v", result)
+	}
+}
@@ -19,3 +19,16 @@ type TeamSelector struct {
 	Team     string
 	Selected bool
 }
+
+// Validation errors keyed by job field name, a field may break several rules
+type FieldErrors map[string][]string
+
+func (errs FieldErrors) Add(field string, message string) {
+	// a rule broken by several items of a field is reported once
+	for _, m := range errs[field] {
+		if m == message {
+			return
+		}
+	}
+	errs[field] = append(errs[field], message)
+}
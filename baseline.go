@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Baseline pinning, later runs are compared against the pinned log of the job
+
+type Tolerance struct {
+	// allowed change against baseline in percent, zero value disables the check
+	P99          float64 // max p99 latency increase
+	Mean         float64 // max mean latency increase
+	Qps          float64 // max qps decrease
+	SuccessRatio float64 // max success ratio decrease
+}
+
+type Regression struct {
+	BaselineLogId string
+	Regressed     bool
+	Failures      []string
+}
+
+func (t Tolerance) IsEmpty() bool {
+	return t == Tolerance{}
+}
+
+func (t Tolerance) Validate(errs FieldErrors) {
+	if t.P99 < 0 || t.Mean < 0 || t.Qps < 0 || t.SuccessRatio < 0 {
+		errs.Add("Tolerance", "tolerance must not be negative")
+	}
+}
+
+func (t Tolerance) Check(comparison *Comparison) *Regression {
+	// judge the second log of comparison against the first one, the baseline
+	var regression = &Regression{BaselineLogId: comparison.Logs[0].Id, Failures: []string{}}
+	for _, period := range comparison.Periods {
+		var delta = period.Cells[1].Delta
+		if delta == nil {
+			continue
+		}
+		var step = fmt.Sprintf("%s %v", comparison.StepName, period.Step)
+		if t.P99 > 0 && delta.P99.Percent > t.P99 {
+			regression.Failures = append(regression.Failures, fmt.Sprintf("%s: p99 %+.1f%% > %+.1f%%", step, delta.P99.Percent, t.P99))
+		}
+		if t.Mean > 0 && delta.Mean.Percent > t.Mean {
+			regression.Failures = append(regression.Failures, fmt.Sprintf("%s: mean %+.1f%% > %+.1f%%", step, delta.Mean.Percent, t.Mean))
+		}
+		if t.Qps > 0 && -delta.Qps.Percent > t.Qps {
+			regression.Failures = append(regression.Failures, fmt.Sprintf("%s: qps %+.1f%% < -%.1f%%", step, delta.Qps.Percent, t.Qps))
+		}
+		if t.SuccessRatio > 0 && -delta.SuccessRatio.Percent > t.SuccessRatio {
+			regression.Failures = append(regression.Failures, fmt.Sprintf("%s: success ratio %+.1f%% < -%.1f%%", step, delta.SuccessRatio.Percent, t.SuccessRatio))
+		}
+	}
+	regression.Regressed = len(regression.Failures) > 0
+	return regression
+}
+
+func EvaluateVegetaRegression(lg *AttackVegetaLog, metricsList []*vegeta.Metrics) *Regression {
+	// nil when the job has no baseline or the baseline is gone
+	var job = lg.JobDetail
+	if job == nil || job.BaselineLogId == "" || job.BaselineLogId == lg.Id.Hex() || job.Tolerance.IsEmpty() {
+		return nil
+	}
+	baseline, err := G_Store.GetVegetaLog(job.BaselineLogId)
+	if err != nil {
+		return nil
+	}
+	var current = *lg
+	current.MetricsList = metricsList
+	comparison, err := CompareVegetaLogs([]*AttackVegetaLog{baseline, &current})
+	if err != nil {
+		return nil
+	}
+	return job.Tolerance.Check(comparison)
+}
+
+func EvaluateBoomRegression(lg *AttackBoomLog, metricsList []*Report) *Regression {
+	var job = lg.JobDetail
+	if job == nil || job.BaselineLogId == "" || job.BaselineLogId == lg.Id.Hex() || job.Tolerance.IsEmpty() {
+		return nil
+	}
+	baseline, err := G_Store.GetBoomLog(job.BaselineLogId)
+	if err != nil {
+		return nil
+	}
+	var current = *lg
+	current.MetricsList = metricsList
+	comparison, err := CompareBoomLogs([]*AttackBoomLog{baseline, &current})
+	if err != nil {
+		return nil
+	}
+	return job.Tolerance.Check(comparison)
+}
+
+func PinVegetaBaseline(lg *AttackVegetaLog) error {
+	// only finished logs can be baselines
+	if lg.IsRunning() {
+		return ErrJobRunning
+	}
+	return G_Store.UpdateVegetaJob(lg.JobId, bson.M{"baselinelogid": lg.Id.Hex(), "lastregression": nil})
+}
+
+func UnpinVegetaBaseline(jobId string) error {
+	return G_Store.UpdateVegetaJob(jobId, bson.M{"baselinelogid": "", "lastregression": nil})
+}
+
+func PinBoomBaseline(lg *AttackBoomLog) error {
+	if lg.IsRunning() {
+		return ErrJobRunning
+	}
+	return G_Store.UpdateBoomJob(lg.JobId, bson.M{"baselinelogid": lg.Id.Hex(), "lastregression": nil})
+}
+
+func UnpinBoomBaseline(jobId string) error {
+	return G_Store.UpdateBoomJob(jobId, bson.M{"baselinelogid": "", "lastregression": nil})
+}
+
+func ParseToleranceForm(req *http.Request) Tolerance {
+	// read tolerance from job edit form, empty inputs disable the check
+	var t Tolerance
+	t.P99, _ = strconv.ParseFloat(req.FormValue("tolerance_p99"), 64)
+	t.Mean, _ = strconv.ParseFloat(req.FormValue("tolerance_mean"), 64)
+	t.Qps, _ = strconv.ParseFloat(req.FormValue("tolerance_qps"), 64)
+	t.SuccessRatio, _ = strconv.ParseFloat(req.FormValue("tolerance_success_ratio"), 64)
+	return t
+}
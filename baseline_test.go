@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test_ToleranceCheck(t *testing.T) {
+	var base = newBoomLogWithReports("job",
+		&Report{Concurrency: 10, Qps: 100, Latency: 10 * time.Millisecond, Latency_P99: 100 * time.Millisecond, SuccessRatio: 100})
+	var current = newBoomLogWithReports("job",
+		&Report{Concurrency: 10, Qps: 80, Latency: 10 * time.Millisecond, Latency_P99: 110 * time.Millisecond, SuccessRatio: 100})
+	comparison, _ := CompareBoomLogs([]*AttackBoomLog{base, current})
+	var regression = Tolerance{P99: 15}.Check(comparison)
+	if regression.Regressed || regression.BaselineLogId != base.Id.Hex() {
+		t.Errorf("p99 +10%% should be tolerated, got %v", regression)
+	}
+	regression = Tolerance{P99: 5, Qps: 10}.Check(comparison)
+	if !regression.Regressed || len(regression.Failures) != 2 {
+		t.Errorf("p99 +10%% and qps -20%% should regress, got %v", regression)
+	}
+}
+
+func Test_ApiVegetaBaseline(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job = NewVegetaJob("baseline", "go", "alex")
+	job.Url = "/ping"
+	job.Hosts = []string{target.Host()}
+	job.Workers = 2
+	job.Periods = []RatePeriod{{10, 1}}
+	G_Store.InsertVegetaJob(job)
+	// fake baseline that any real run is slower than
+	var metrics = &vegeta.Metrics{Requests: 10, Rate: 10, Success: 1}
+	metrics.Latencies.P99 = time.Microsecond
+	var baseline = &AttackVegetaLog{Id: bson.NewObjectId(), JobId: job.Id.Hex(), JobDetail: job, State: "End", MetricsList: []*vegeta.Metrics{metrics}}
+	G_Store.InsertVegetaLog(baseline)
+
+	var view VegetaJobView
+	var code = doJsonRequest(h, "POST", "/api/v1/vegeta/logs/"+baseline.Id.Hex()+"/baseline", nil, &view)
+	if code != 200 || view.BaselineLogId != baseline.Id.Hex() {
+		t.Fatalf("log should be pinned, got %d %v", code, view.VegetaJob)
+	}
+	job, _ = G_Store.GetVegetaJob(job.Id.Hex())
+	lg, err := StartVegetaJob(job, "regressed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobDone(t, G_RunningVegetaJobs, job.Id.Hex())
+	lg, _ = G_Store.GetVegetaLog(lg.Id.Hex())
+	if lg.Regression == nil || !lg.Regression.Regressed || lg.Regression.BaselineLogId != baseline.Id.Hex() {
+		t.Fatalf("slower run should regress against baseline, got %v", lg.Regression)
+	}
+	doJsonRequest(h, "GET", "/api/v1/vegeta/jobs/"+job.Id.Hex(), nil, &view)
+	if view.LastRegression == nil || !view.LastRegression.Regressed {
+		t.Errorf("job should keep last regression, got %v", view.LastRegression)
+	}
+	if w := doRequest(h, "GET", "/vegeta/", nil); w.Code != 200 || !strings.Contains(w.Body.String(), "Regression") {
+		t.Errorf("job list should show regression badge, got %d", w.Code)
+	}
+
+	if code = doJsonRequest(h, "DELETE", "/api/v1/vegeta/jobs/"+job.Id.Hex()+"/baseline", nil, nil); code != http.StatusNoContent {
+		t.Errorf("baseline should be unpinned, got %d", code)
+	}
+	doJsonRequest(h, "GET", "/api/v1/vegeta/jobs/"+job.Id.Hex(), nil, &view)
+	if view.BaselineLogId != "" || view.LastRegression != nil {
+		t.Errorf("unpinned job should forget baseline, got %v", view.VegetaJob)
+	}
+	if code = doJsonRequest(h, "POST", "/api/v1/vegeta/logs/unknown/baseline", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown log should not be pinned, got %d", code)
+	}
+}
+
+func Test_PartialRunsNotJudged(t *testing.T) {
+	setupTestServer()
+	var job = NewBoomJob("partial", "go", "alex")
+	job.Thresholds = Thresholds{MinQps: 1000}
+	job.LastRegression = &Regression{BaselineLogId: "previous", Failures: []string{}}
+	G_Store.InsertBoomJob(job)
+	var baseline = newBoomLogWithReports(job.Id.Hex(),
+		&Report{Concurrency: 10, Qps: 100, Latency: 10 * time.Millisecond, Latency_P99: 10 * time.Millisecond, SuccessRatio: 100})
+	G_Store.InsertBoomLog(baseline)
+	job.BaselineLogId = baseline.Id.Hex()
+	for _, state := range []string{"Stopped", "Aborted", "End"} {
+		var lg = newBoomLogWithReports(job.Id.Hex(),
+			&Report{Concurrency: 10, Qps: 10, Latency: 100 * time.Millisecond, Latency_P99: 100 * time.Millisecond, SuccessRatio: 100})
+		lg.JobDetail = job
+		lg.State = state
+		G_Store.InsertBoomLog(lg)
+		LogAttackBoomEnd(lg, lg.MetricsList)
+		lg, _ = G_Store.GetBoomLog(lg.Id.Hex())
+		stored, _ := G_Store.GetBoomJob(job.Id.Hex())
+		if state != "End" && (lg.Verdict != nil || lg.Regression != nil || stored.LastRegression.BaselineLogId != "previous") {
+			t.Errorf("%s run should be neither judged nor compared, got %v %v", state, lg.Verdict, lg.Regression)
+		}
+		if state == "End" && (lg.Verdict == nil || lg.Regression == nil || stored.LastRegression.BaselineLogId != baseline.Id.Hex()) {
+			t.Errorf("finished run should be judged and compared, got %v %v", lg.Verdict, lg.Regression)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+type BoltKV struct {
+	// single file embedded storage, needs no external services
+	db *bolt.DB
+}
+
+func OpenBoltKV(path string) (*BoltKV, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltKV{db}, nil
+}
+
+func (kv *BoltKV) Close() error {
+	return kv.db.Close()
+}
+
+func (kv *BoltKV) Get(bucket string, key string) ([]byte, error) {
+	var value []byte
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		var b = tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+		var v = b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		// values are only valid inside the transaction
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return value, err
+}
+
+func (kv *BoltKV) Put(bucket string, key string, value []byte) error {
+	return kv.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (kv *BoltKV) Modify(bucket string, key string, fn func(value []byte) ([]byte, error)) error {
+	return kv.db.Update(func(tx *bolt.Tx) error {
+		var b = tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+		var v = b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		value, err := fn(v)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (kv *BoltKV) Delete(bucket string, key string) error {
+	return kv.db.Update(func(tx *bolt.Tx) error {
+		var b = tx.Bucket([]byte(bucket))
+		if b == nil || b.Get([]byte(key)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (kv *BoltKV) ForEach(bucket string, fn func(value []byte) error) error {
+	return kv.db.View(func(tx *bolt.Tx) error {
+		var b = tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(v)
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func openTestBoltStore(t *testing.T, path string) *DocStore {
+	kv, err := OpenBoltKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDocStore(kv)
+}
+
+func Test_BoltStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "alex")
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "alex.db")
+	var store = openTestBoltStore(t, path)
+
+	if _, err := store.GetVegetaJob(bson.NewObjectId().Hex()); err != ErrNotFound {
+		t.Errorf("missing bucket should not be found, got %v", err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		var job = &VegetaJob{Id: bson.NewObjectId(), Name: "bolt", Team: "go", Project: "alex", LastRunTs: int64(i)}
+		if err := store.InsertVegetaJob(job); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.Id.Hex())
+	}
+	var other = &VegetaJob{Id: bson.NewObjectId(), Name: "bolt", Team: "java", Project: "alex"}
+	store.InsertVegetaJob(other)
+
+	job, err := store.GetVegetaJob(ids[0])
+	if err != nil || job.Name != "bolt" || job.Team != "go" {
+		t.Fatalf("inserted job should be read back, got %v %v", job, err)
+	}
+	if err = store.UpdateVegetaJob(ids[0], bson.M{"name": "renamed", "lastrunts": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ = store.GetVegetaJob(ids[0]); job.Name != "renamed" || job.Team != "go" {
+		t.Errorf("update should change given fields only, got %s %s", job.Name, job.Team)
+	}
+	var cond = JobCondition{Team: "go"}
+	if total, _ := store.CountVegetaJobs(cond); total != 3 {
+		t.Errorf("count should follow condition, got %d", total)
+	}
+	jobs, err := store.FindVegetaJobs(cond, 1, 1)
+	if err != nil || len(jobs) != 1 || jobs[0].Id.Hex() != ids[2] {
+		t.Errorf("second page should hold the second recently run job, got %v %v", jobs, err)
+	}
+	if jobs, _ = store.FindVegetaJobs(cond, 0, 0); len(jobs) != 3 || jobs[0].Id.Hex() != ids[0] {
+		t.Errorf("jobs should be ordered by last run, got %v", jobs)
+	}
+	if jobs, _ = store.FindVegetaJobs(cond, 5, 2); len(jobs) != 0 {
+		t.Errorf("page after the end should be empty, got %v", jobs)
+	}
+
+	if err = store.RemoveVegetaJob(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.GetVegetaJob(ids[1]); err != ErrNotFound {
+		t.Errorf("removed job should not be found, got %v", err)
+	}
+	if err = store.UpdateVegetaJob(ids[1], bson.M{"name": "gone"}); err != ErrNotFound {
+		t.Errorf("removed job should not be updated, got %v", err)
+	}
+	if err = store.RemoveVegetaJob(ids[1]); err != ErrNotFound {
+		t.Errorf("removed job should not be removed again, got %v", err)
+	}
+
+	var lg = &AttackBoomLog{Id: bson.NewObjectId(), JobId: ids[0], State: "Running", StartTs: 1}
+	store.InsertBoomLog(lg)
+	store.UpdateBoomLog(lg.Id.Hex(), bson.M{"state": "End"})
+	store.Close()
+
+	// data survives reopening the file
+	store = openTestBoltStore(t, path)
+	defer store.Close()
+	if job, err = store.GetVegetaJob(ids[0]); err != nil || job.Name != "renamed" || job.LastRunTs != 10 {
+		t.Errorf("updated job should be persisted, got %v %v", job, err)
+	}
+	if total, _ := store.CountVegetaJobs(JobCondition{}); total != 3 {
+		t.Errorf("removed job should stay removed, got %d jobs", total)
+	}
+	logs, err := store.FindBoomLogs(LogCondition{JobId: ids[0]}, 0, 0)
+	if err != nil || len(logs) != 1 || logs[0].Id != lg.Id || logs[0].State != "End" {
+		t.Errorf("updated log should be persisted, got %v %v", logs, err)
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/martini-contrib/render"
@@ -49,6 +51,20 @@ type BoomJob struct {
 	Periods []ConcurrencyPeriod
 	// Concurrent Job Concurrency in running
 	CurrentConcurrency int
+	// pass/fail thresholds for each period
+	Thresholds Thresholds
+	// response checks counting mismatches as failures
+	Assertions Assertions
+	// pinned log later runs are compared against
+	BaselineLogId string
+	// allowed change against baseline
+	Tolerance Tolerance
+	// regression of the last run against baseline
+	LastRegression *Regression
+	// live rules aborting the attack on overload
+	AbortRules AbortRules
+	// attack from registered agents instead of this process
+	Distributed bool
 }
 
 func (job *BoomJob) IsRunning() bool {
@@ -56,33 +72,147 @@ func (job *BoomJob) IsRunning() bool {
 	return G_RunningBoomJobs.Exists(job.Id.Hex())
 }
 
+func NewBoomJob(name string, team string, project string) *BoomJob {
+	// new job with default settings
+	return &BoomJob{
+		Id:                 bson.NewObjectId(),
+		Name:               name,
+		Team:               team,
+		Hosts:              []string{"localhost:8000"},
+		Project:            project,
+		Method:             "GET",
+		Jsonified:          false,
+		Seeds:              []RequestSeed{RequestSeed{}},
+		CreateTs:           time.Now().Unix(),
+		LastRunTs:          time.Now().Unix(),
+		DisableKeepAlive:   false,
+		DisableCompression: false,
+		Timeout:            10,
+		Periods:            []ConcurrencyPeriod{ConcurrencyPeriod{10, 5}},
+		Tolerance:          Tolerance{P99: 15},
+	}
+}
+
+func (job *BoomJob) Validate() FieldErrors {
+	// check job settings before saving
+	var errs = FieldErrors{}
+	if job.Name == "" {
+		errs.Add("Name", "name is required")
+	}
+	if job.Url != "" && !strings.HasPrefix(job.Url, "/") {
+		errs.Add("Url", "url must start with /")
+	}
+	if !IsValidMethod(job.Method) {
+		errs.Add("Method", "unsupported http method")
+	}
+	for _, host := range job.Hosts {
+		if host == "" {
+			errs.Add("Hosts", "host:port must not be empty")
+		}
+	}
+	if len(job.Seeds) == 0 {
+		errs.Add("Seeds", "at least one parameter seed is required")
+	}
+	if job.Timeout <= 0 {
+		errs.Add("Timeout", "timeout must be positive")
+	}
+	for _, period := range job.Periods {
+		if period.Concurrency <= 0 || period.Duration <= 0 {
+			errs.Add("Periods", "concurrency and duration must be positive")
+		}
+	}
+	job.Thresholds.Validate(errs)
+	job.Assertions.Validate(errs)
+	job.Tolerance.Validate(errs)
+	job.AbortRules.Validate(errs)
+	return errs
+}
+
+func (job *BoomJob) ValidateRun() FieldErrors {
+	// check job is ready for attacking
+	var errs = job.Validate()
+	if job.Url == "" {
+		errs.Add("Url", "url is required")
+	}
+	if len(job.Hosts) == 0 {
+		errs.Add("Hosts", "at least one host:port is required")
+	}
+	if len(job.Periods) == 0 {
+		errs.Add("Periods", "at least one concurrency step is required")
+	}
+	if job.Distributed && len(G_Agents.Live()) == 0 {
+		errs.Add("Distributed", ErrNoAgents.Error())
+	}
+	return errs
+}
+
+func SaveBoomJob(job *BoomJob) error {
+	// persist user editable settings
+	var changed = bson.M{
+		"name":               job.Name,
+		"team":               job.Team,
+		"project":            job.Project,
+		"method":             job.Method,
+		"url":                job.Url,
+		"hosts":              job.Hosts,
+		"jsonified":          job.Jsonified,
+		"seeds":              job.Seeds,
+		"timeout":            job.Timeout,
+		"disablekeepalive":   job.DisableKeepAlive,
+		"disablecompression": job.DisableCompression,
+		"periods":            job.Periods,
+		"thresholds":         job.Thresholds,
+		"assertions":         job.Assertions,
+		"tolerance":          job.Tolerance,
+		"abortrules":         job.AbortRules,
+		"distributed":        job.Distributed,
+	}
+	return G_Store.UpdateBoomJob(job.Id.Hex(), changed)
+}
+
+func StartBoomJob(job *BoomJob, comment string) (*AttackBoomLog, error) {
+	// persist run settings and start attacking in background
+	if job.Distributed && len(G_Agents.Live()) == 0 {
+		return nil, ErrNoAgents
+	}
+	if !G_RunningBoomJobs.PutIfAbsent(job.Id.Hex()) {
+		return nil, ErrJobRunning
+	}
+	job.LastRunTs = time.Now().Unix()
+	var changed = bson.M{
+		"timeout":            job.Timeout,
+		"disablekeepalive":   job.DisableKeepAlive,
+		"disablecompression": job.DisableCompression,
+		"periods":            job.Periods,
+		"distributed":        job.Distributed,
+		"lastrunts":          job.LastRunTs,
+	}
+	err := G_Store.UpdateBoomJob(job.Id.Hex(), changed)
+	if err != nil {
+		G_RunningBoomJobs.Delete(job.Id.Hex())
+		return nil, err
+	}
+	var lg = LogAttackBoomStart(job, comment)
+	// the attack keeps writing to lg, callers get the log as started
+	var started = *lg
+	go AttackBoomJob(job, lg)
+	return &started, nil
+}
+
 func GetBoomJobs(req *http.Request, r render.Render) {
 	var team = req.FormValue("team")
 	var project = req.FormValue("project")
 	var url = req.FormValue("url")
 	var page = req.FormValue("p")
-	var condition = bson.M{}
-	if team != "" {
-		condition["team"] = team
-	}
-	if project != "" {
-		condition["project"] = project
-	}
-	if url != "" {
-		condition["url"] = bson.M{"$regex": bson.RegEx{fmt.Sprintf("^%s", url), ""}}
-	}
-	if len(condition) == 0 {
-		condition = nil
-	}
-	total, err := G_MongoDB.C("boom_jobs").Find(condition).Count()
+	var condition = JobCondition{team, project, url}
+	total, err := G_Store.CountBoomJobs(condition)
 	if err != nil {
 		log.Panic(err)
 	}
 	var pager = NewPager(20, total)
 	pager.CurrentPage, err = strconv.Atoi(page)
 	pager.UrlPattern = fmt.Sprintf("/boom/?p=%%d&team=%s&project=%s", team, project)
-	var jobs []BoomJob
-	err = G_MongoDB.C("boom_jobs").Find(condition).Skip(pager.Offset()).Sort("-lastrunts").Limit(pager.Limit()).All(&jobs)
+	jobs, err := G_Store.FindBoomJobs(condition, pager.Offset(), pager.Limit())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -99,22 +229,8 @@ func CreateBoomJob(req *http.Request, r render.Render) {
 	var name = req.FormValue("name")
 	var team = req.FormValue("team")
 	var project = req.FormValue("project")
-	var job = BoomJob{
-		Id:                 bson.NewObjectId(),
-		Name:               name,
-		Team:               team,
-		Hosts:              []string{"localhost:8000"},
-		Project:            project,
-		Jsonified:          false,
-		Seeds:              []RequestSeed{RequestSeed{}},
-		CreateTs:           time.Now().Unix(),
-		LastRunTs:          time.Now().Unix(),
-		DisableKeepAlive:   false,
-		DisableCompression: false,
-		Timeout:            10,
-		Periods:            []ConcurrencyPeriod{ConcurrencyPeriod{10, 5}},
-	}
-	err := G_MongoDB.C("boom_jobs").Insert(&job)
+	var job = NewBoomJob(name, team, project)
+	err := G_Store.InsertBoomJob(job)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -125,17 +241,21 @@ type BoomEditForm struct {
 	Job     *BoomJob
 	Methods []MethodSelector
 	Teams   []TeamSelector
+	Errors  FieldErrors
 }
 
 func EditBoomJobPage(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
-	var job BoomJob
-	err := G_MongoDB.C("boom_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetBoomJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
+	renderBoomEditForm(r, job, nil)
+}
+
+func renderBoomEditForm(r render.Render, job *BoomJob, errs FieldErrors) {
 	var context = make(map[string]interface{})
-	var form = BoomEditForm{Job: &job}
+	var form = BoomEditForm{Job: job, Errors: errs}
 	form.Methods = GenMethodSelectors(job.Method)
 	form.Teams = GenTeamSelectors(job.Team)
 	context["form"] = form
@@ -145,8 +265,7 @@ func EditBoomJobPage(req *http.Request, r render.Render) {
 func EditBoomJob(req *http.Request, r render.Render) {
 	req.ParseForm()
 	var jobId = req.FormValue("job_id")
-	var job BoomJob
-	err := G_MongoDB.C("boom_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetBoomJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -195,18 +314,16 @@ func EditBoomJob(req *http.Request, r render.Render) {
 			job.Seeds[i].JsonData = jsonDataSeeds[i]
 		}
 	}
-	var changed = bson.M{
-		"name":      job.Name,
-		"team":      job.Team,
-		"project":   job.Project,
-		"method":    job.Method,
-		"url":       job.Url,
-		"hosts":     job.Hosts,
-		"jsonified": job.Jsonified,
-		"seeds":     job.Seeds,
-	}
-	var op = bson.M{"$set": changed}
-	err = G_MongoDB.C("boom_jobs").UpdateId(job.Id, op)
+	job.Thresholds = ParseThresholdsForm(req)
+	job.Assertions = ParseAssertionsForm(req)
+	job.Tolerance = ParseToleranceForm(req)
+	job.AbortRules = ParseAbortRulesForm(req)
+	if errs := job.Validate(); len(errs) > 0 {
+		// edited settings are kept in the form for fixing
+		renderBoomEditForm(r, job, errs)
+		return
+	}
+	err = SaveBoomJob(job)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -214,7 +331,15 @@ func EditBoomJob(req *http.Request, r render.Render) {
 }
 
 type BoomRunForm struct {
-	Job *BoomJob
+	Job    *BoomJob
+	Errors FieldErrors
+}
+
+func renderBoomRunForm(r render.Render, job *BoomJob, errs FieldErrors) {
+	var context = make(map[string]interface{})
+	context["form"] = BoomRunForm{Job: job, Errors: errs}
+	context["agents"] = G_Agents.Live()
+	RenderTemplate(r, "boom_run", context)
 }
 
 func RunBoomJobPage(req *http.Request, r render.Render) {
@@ -223,28 +348,24 @@ func RunBoomJobPage(req *http.Request, r render.Render) {
 		r.Redirect(req.Referer())
 		return
 	}
-	var job BoomJob
-	err := G_MongoDB.C("boom_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetBoomJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
-	var form = BoomRunForm{&job}
-	var context = make(map[string]interface{})
-	context["form"] = form
-	RenderTemplate(r, "boom_run", context)
+	renderBoomRunForm(r, job, nil)
 }
 
 func RunBoomJob(req *http.Request, r render.Render) {
 	req.ParseForm()
 	var jobId = req.FormValue("job_id")
-	var job BoomJob
-	err := G_MongoDB.C("boom_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetBoomJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
 	var timeout, _ = strconv.Atoi(req.FormValue("timeout"))
 	var disableKeepAlive = req.FormValue("disable_keepalive") != ""
 	var disableCompression = req.FormValue("disable_compression") != ""
+	var distributed = req.FormValue("distributed") != ""
 	var concurrencies = req.Form["concurrency"]
 	var durations = req.Form["duration"]
 	var comment = req.FormValue("comment")
@@ -258,27 +379,28 @@ func RunBoomJob(req *http.Request, r render.Render) {
 	job.DisableKeepAlive = disableKeepAlive
 	job.DisableCompression = disableCompression
 	job.Periods = periods
-	var changed = bson.M{
-		"timeout":            job.Timeout,
-		"disablekeepalive":   job.DisableKeepAlive,
-		"disablecompression": job.DisableCompression,
-		"periods":            job.Periods,
-		"lastrunts":          time.Now().Unix(),
+	job.Distributed = distributed
+	if errs := job.ValidateRun(); len(errs) > 0 {
+		// run settings are kept in the form for fixing
+		renderBoomRunForm(r, job, errs)
+		return
 	}
-	var op = bson.M{"$set": changed}
-	err = G_MongoDB.C("boom_jobs").UpdateId(job.Id, op)
-	if err != nil {
+	_, err = StartBoomJob(job, comment)
+	if err == ErrNoAgents {
+		renderBoomRunForm(r, job, FieldErrors{"Distributed": {err.Error()}})
+		return
+	}
+	if err != nil && err != ErrJobRunning {
 		log.Panic(err)
 	}
-	G_RunningBoomJobs.Put(job.Id.Hex())
-	go AttackBoomJob(&job, comment)
 	r.Redirect("/boom/")
 }
 
 func DeleteBoomJob(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
 	G_RunningBoomJobs.Delete(jobId)
-	err := G_MongoDB.C("boom_jobs").RemoveId(bson.ObjectIdHex(jobId))
+	G_Exporter.Forget("boom", jobId)
+	err := G_Store.RemoveBoomJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -288,7 +410,7 @@ func DeleteBoomJob(req *http.Request, r render.Render) {
 func StopBoomJob(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
 	if G_RunningBoomJobs.Exists(jobId) {
-		G_StoppingBoomJobs.Put(jobId)
+		StopBoomAttack(jobId)
 	}
 	r.Redirect(req.Referer())
 }
@@ -296,34 +418,54 @@ func StopBoomJob(req *http.Request, r render.Render) {
 func GetBoomLogs(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
 	var page = req.FormValue("p")
-	var logs []AttackBoomLog
-	var condition = bson.M{}
-	if jobId != "" {
-		condition = bson.M{"jobid": jobId}
-	} else {
-		condition = nil
-	}
-	total, err := G_MongoDB.C("boom_logs").Find(condition).Count()
+	var condition = LogCondition{JobId: jobId}
+	total, err := G_Store.CountBoomLogs(condition)
 	if err != nil {
 		log.Panic(err)
 	}
 	var pager = NewPager(20, total)
 	pager.CurrentPage, err = strconv.Atoi(page)
 	pager.UrlPattern = fmt.Sprintf("/boom/logs?&p=%%d&job_id=%s", jobId)
-	err = G_MongoDB.C("boom_logs").Find(condition).Skip(pager.Offset()).Sort("-startts").Limit(pager.Limit()).All(&logs)
+	logs, err := G_Store.FindBoomLogs(condition, pager.Offset(), pager.Limit())
 	if err != nil {
 		log.Panic(err)
 	}
 	var context = make(map[string]interface{})
 	context["logs"] = logs
 	context["jobId"] = jobId
+	if job, err := G_Store.GetBoomJob(jobId); err == nil {
+		context["baselineId"] = job.BaselineLogId
+	}
 	context["pager"] = pager
 	RenderTemplate(r, "boom_logs", context)
 }
 
 func DeleteBoomLog(req *http.Request, r render.Render) {
-	var logId = bson.ObjectIdHex(req.FormValue("log_id"))
-	err := G_MongoDB.C("boom_logs").RemoveId(logId)
+	var logId = req.FormValue("log_id")
+	err := G_Store.RemoveBoomLog(logId)
+	if err != nil {
+		log.Panic(err)
+	}
+	r.Redirect(req.Referer())
+}
+
+func PinBoomLog(req *http.Request, r render.Render) {
+	// pin log as baseline of its job
+	var logId = req.FormValue("log_id")
+	lg, err := G_Store.GetBoomLog(logId)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = PinBoomBaseline(lg)
+	if err != nil && err != ErrJobRunning {
+		log.Panic(err)
+	}
+	r.Redirect(req.Referer())
+}
+
+func UnpinBoomJob(req *http.Request, r render.Render) {
+	var jobId = req.FormValue("job_id")
+	err := UnpinBoomBaseline(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -331,17 +473,31 @@ func DeleteBoomLog(req *http.Request, r render.Render) {
 }
 
 func GetBoomMetrics(req *http.Request, r render.Render) {
-	var lg AttackBoomLog
-	var lgId = bson.ObjectIdHex(req.FormValue("log_id"))
-	err := G_MongoDB.C("boom_logs").FindId(lgId).One(&lg)
+	var lgId = req.FormValue("log_id")
+	lg, err := G_Store.GetBoomLog(lgId)
 	if err != nil {
 		log.Panic(err)
 	}
 	var context = make(map[string]interface{})
-	context["log"] = &lg
+	context["log"] = lg
 	RenderTemplate(r, "boom_metrics", context)
 }
 
+func GetBoomComparison(req *http.Request, r render.Render) {
+	req.ParseForm()
+	logs, err := LoadBoomLogs(req.Form["log_id"])
+	if err != nil {
+		log.Panic(err)
+	}
+	comparison, err := CompareBoomLogs(logs)
+	if err != nil {
+		log.Panic(err)
+	}
+	var context = make(map[string]interface{})
+	context["comparison"] = comparison
+	RenderTemplate(r, "compare", context)
+}
+
 type AttackBoomLog struct {
 	Id        bson.ObjectId `json:"id"        bson:"_id,omitempty"`
 	JobId     string
@@ -352,22 +508,64 @@ type AttackBoomLog struct {
 	State     string
 	// Report List matching job stepping settings
 	MetricsList []*Report
-	StartTs     int64
-	EndTs       int64
+	// per-second statistics of the whole attack
+	Series TimeSeries
+	// pass/fail verdict of each period and the whole attack, nil without thresholds
+	Verdicts []*Verdict
+	Verdict  *Verdict
+	// comparison against job baseline, nil without baseline
+	Regression *Regression
+	// abort rule fired, empty unless aborted
+	AbortReason string
+	// addresses of agents attacking, empty for attacks of this process
+	Agents []string
+	// results of each agent in each period
+	AgentStats []*AgentPeriodStats
+	// spread between the earliest and latest agent start of each period
+	StartSkews []time.Duration
+	StartTs    int64
+	EndTs      int64
 }
 
 func (log *AttackBoomLog) IsRunning() bool {
 	return log.State == "Running"
 }
 
+func (log *AttackBoomLog) MaxStartSkew() time.Duration {
+	// worst start skew between agents over all periods
+	var max time.Duration
+	for _, skew := range log.StartSkews {
+		if skew > max {
+			max = skew
+		}
+	}
+	return max
+}
+
+func (log *AttackBoomLog) PeriodVerdict(i int) *Verdict {
+	// verdict of the i-th period, nil without thresholds
+	if i < len(log.Verdicts) {
+		return log.Verdicts[i]
+	}
+	return nil
+}
+
 func (log *AttackBoomLog) ConcurrencyLatencyMetrics() string {
 	var buffer bytes.Buffer
 	for _, metrics := range log.MetricsList {
-		buffer.WriteString(fmt.Sprintf("%v,%v\n", metrics.Concurrency, metrics.Latency))
+		buffer.WriteString(fmt.Sprintf("%v,%v\n", metrics.Concurrency, metrics.Latency.Seconds()*1000))
 	}
 	return buffer.String()
 }
 
+func (log *AttackBoomLog) PercentileTable() PercentileTable {
+	var table PercentileTable
+	for _, metrics := range log.MetricsList {
+		table = append(table, &PercentileRow{fmt.Sprintf("Concurrency %d", metrics.Concurrency), metrics.Percentiles})
+	}
+	return table
+}
+
 func (log *AttackBoomLog) StatusCodesList() map[string]bool {
 	var codeList = make(map[string]bool)
 	for _, metrics := range log.MetricsList {
@@ -404,38 +602,128 @@ func (log *AttackBoomLog) StatusCodesMetrics() string {
 	return buffer.String()
 }
 
-func AttackBoomJob(job *BoomJob, comment string) {
+func AttackBoomJob(job *BoomJob, log *AttackBoomLog) {
 	// Begin attack target services
-	var log = LogAttackBoomStart(job, comment)
 	var metricsList []*Report
+	checker, err := NewResponseChecker(job.Assertions)
+	if err != nil {
+		// jobs saved before validation may hold broken assertions
+		log.State = "Aborted"
+		log.AbortReason = err.Error()
+		UpdateJobCurrentConcurrency(job, 0)
+		LogAttackBoomEnd(log, metricsList)
+		G_RunningBoomJobs.Delete(job.Id.Hex())
+		G_LiveHub.Publish(job.Id.Hex(), &LiveEvent{State: log.State, LogId: log.Id.Hex()})
+		return
+	}
 	shooter := NewRandomBoomShooter(job)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stopped = false
+	breaker := NewCircuitBreaker(job.AbortRules, cancel)
+	exported := G_Exporter.Job("boom", job.Id.Hex(), job.Name)
+	tags := NewSinkTags("boom", job.Id.Hex(), job.Team, job.Project, job.Hosts)
+	start := time.Now()
+	series := NewTimeSeriesCollector(start)
+	series.Run(func(stats *SecondStats) {
+		exported.SetRate(stats.Requests)
+		G_LiveHub.Publish(job.Id.Hex(), NewLiveSecondEvent(log.Id.Hex(), stats))
+		if G_MetricsSink != nil {
+			G_MetricsSink.Write(tags, start, stats)
+		}
+	})
+	var group *AgentGroup
+	if len(log.Agents) > 0 {
+		group = NewAgentGroup(log.Id.Hex(), log.Agents, start)
+		G_BoomCancels.Put(job.Id.Hex(), group.Stop)
+	} else {
+		G_BoomCancels.Put(job.Id.Hex(), cancel)
+	}
+	flusher := StartLogFlusher(G_LogFlushInterval, func() {
+		LogAttackBoomSeries(log, series.Closed())
+	})
+	if G_StoppingBoomJobs.Exists(job.Id.Hex()) {
+		// stopped before attack was cancellable
+		G_BoomCancels.Cancel(job.Id.Hex())
+	}
 	for _, period := range job.Periods {
 		var duration = time.Duration(period.Duration) * time.Second
 		var boomer = Boomer{
 			Shooter:            shooter,
 			Duration:           duration,
 			Concurrency:        period.Concurrency,
+			Period:             len(metricsList),
 			Timeout:            job.Timeout,
 			DisableCompression: job.DisableCompression,
 			DisableKeepAlive:   job.DisableKeepAlive,
+			Checker:            checker,
+			Breaker:            breaker,
+			Series:             series,
+			Exporter:           exported,
 		}
 		UpdateJobCurrentConcurrency(job, period.Concurrency)
-		var metrics = boomer.Run()
+		var metrics *Report
+		if group != nil {
+			var command = AgentPeriodCommand{Period: len(metricsList), Engine: "boom", BoomJob: job, Concurrency: period.Concurrency, Duration: uint(period.Duration)}
+			metrics = MergeBoomResults(group.RunPeriod(command, job.Timeout, series), period.Concurrency)
+			exported.ObserveHistogram(metrics.latencies, metrics.Requests, BoomErrorCount(metrics))
+		} else {
+			metrics = boomer.Run(ctx)
+		}
 		metricsList = append(metricsList, metrics)
+		if group != nil {
+			log.AgentStats = group.Stats()
+			log.StartSkews = group.StartSkews()
+		}
+		LogAttackBoomPeriod(log, metricsList)
+		if breaker != nil && breaker.Reason() != "" {
+			log.AbortReason = breaker.Reason()
+			break
+		}
+		if group != nil && group.AbortReason() != "" {
+			log.AbortReason = group.AbortReason()
+			break
+		}
 		if G_StoppingBoomJobs.Exists(job.Id.Hex()) {
 			G_StoppingBoomJobs.Delete(job.Id.Hex())
+			stopped = true
 			break
 		}
 	}
-	G_RunningBoomJobs.Delete(job.Id.Hex())
+	G_BoomCancels.Delete(job.Id.Hex())
+	G_StoppingBoomJobs.Delete(job.Id.Hex())
+	flusher.Stop()
+	log.Series = series.Close()
+	if group != nil {
+		group.Finish()
+		log.AgentStats = group.Stats()
+		log.StartSkews = group.StartSkews()
+	}
+	exported.SetRate(0)
+	log.State = "End"
+	if stopped {
+		log.State = "Stopped"
+	}
+	if log.AbortReason != "" {
+		log.State = "Aborted"
+	}
 	UpdateJobCurrentConcurrency(job, 0)
 	LogAttackBoomEnd(log, metricsList)
+	// leave the running set only after the final state is stored
+	G_RunningBoomJobs.Delete(job.Id.Hex())
+	G_LiveHub.Publish(job.Id.Hex(), &LiveEvent{State: log.State, LogId: log.Id.Hex()})
+}
+
+func StopBoomAttack(jobId string) {
+	// cancel boom workers at once, remaining periods are skipped
+	G_StoppingBoomJobs.Put(jobId)
+	G_BoomCancels.Cancel(jobId)
 }
 
 func UpdateJobCurrentConcurrency(job *BoomJob, concurrency int) {
 	// realtime update job concurrency for displaying
-	var op = bson.M{"$set": bson.M{"currentconcurrency": concurrency}}
-	err := G_MongoDB.C("boom_jobs").UpdateId(job.Id, op)
+	G_Exporter.Job("boom", job.Id.Hex(), job.Name).SetTarget(int64(concurrency))
+	err := G_Store.UpdateBoomJob(job.Id.Hex(), bson.M{"currentconcurrency": concurrency})
 	if err != nil {
 		log.Panic(err)
 	}
@@ -454,20 +742,83 @@ func LogAttackBoomStart(job *BoomJob, comment string) *AttackBoomLog {
 		StartTs:   time.Now().Unix(),
 		EndTs:     0,
 	}
-	err := G_MongoDB.C("boom_logs").Insert(&lg)
+	if job.Distributed {
+		lg.Agents = G_Agents.LiveAddresses()
+	}
+	err := G_Store.InsertBoomLog(&lg)
 	if err != nil {
 		log.Panic(err)
 	}
 	return &lg
 }
 
+func LogAttackBoomPeriod(lg *AttackBoomLog, metricsList []*Report) {
+	// persist completed periods, they survive a crash of this process
+	var changed = bson.M{"metricslist": metricsList}
+	if len(lg.AgentStats) > 0 {
+		changed["agentstats"] = lg.AgentStats
+		changed["startskews"] = lg.StartSkews
+	}
+	err := G_Store.UpdateBoomLog(lg.Id.Hex(), changed)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func LogAttackBoomSeries(lg *AttackBoomLog, series TimeSeries) {
+	// persist seconds of the running period
+	err := G_Store.UpdateBoomLog(lg.Id.Hex(), bson.M{"series": series})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
 func LogAttackBoomEnd(lg *AttackBoomLog, metricsList []*Report) {
 	// Record job reports after job finished
-	var op = bson.M{"$set": bson.M{"metricslist": metricsList, "state": "End", "endts": time.Now().Unix()}}
-	for k, v := range metricsList[0].ErrorDist {
-		fmt.Printf("%#v, %#v\n", k, v)
+	var changed = bson.M{"metricslist": metricsList, "series": lg.Series, "state": lg.State, "endts": time.Now().Unix()}
+	if lg.AbortReason != "" {
+		changed["abortreason"] = lg.AbortReason
+	}
+	if len(lg.AgentStats) > 0 {
+		changed["agentstats"] = lg.AgentStats
+		changed["startskews"] = lg.StartSkews
+	}
+	// stopped and aborted runs are partial, they are neither judged nor compared
+	var finished = lg.State == "End"
+	if finished && lg.JobDetail != nil && !lg.JobDetail.Thresholds.IsEmpty() {
+		var verdicts []*Verdict
+		for _, report := range metricsList {
+			verdicts = append(verdicts, lg.JobDetail.Thresholds.CheckBoom(report))
+		}
+		changed["verdicts"] = verdicts
+		changed["verdict"] = MergeVerdicts(verdicts)
+	}
+	var regression *Regression
+	if finished {
+		regression = EvaluateBoomRegression(lg, metricsList)
+	}
+	if regression != nil {
+		changed["regression"] = regression
+		err := G_Store.UpdateBoomJob(lg.JobId, bson.M{"lastregression": regression})
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	if len(metricsList) > 0 {
+		for k, v := range metricsList[0].ErrorDist {
+			fmt.Printf("%#v, %#v\n", k, v)
+		}
 	}
-	err := G_MongoDB.C("boom_logs").UpdateId(lg.Id, op)
+	err := G_Store.UpdateBoomLog(lg.Id.Hex(), changed)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func LogAttackBoomInterrupted(lg *AttackBoomLog) {
+	// keep the completed periods of a crashed attack, an unfinished run is neither judged nor compared
+	var changed = bson.M{"metricslist": lg.MetricsList, "state": "Interrupted", "endts": time.Now().Unix()}
+	err := G_Store.UpdateBoomLog(lg.Id.Hex(), changed)
 	if err != nil {
 		log.Panic(err)
 	}
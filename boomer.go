@@ -2,18 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"fmt"
-	"github.com/streadway/quantile"
+	"errors"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+var errRequestTimeout = errors.New("request timeout")
+
 type result struct {
 	err        error
 	statusCode int
@@ -49,68 +52,137 @@ func (s *RandomShooter) Next() *http.Request {
 }
 
 type Boomer struct {
-	Shooter            IShooter      // requests shooter
-	Duration           time.Duration // time for attacking
-	Concurrency        int           // go routines count
-	Timeout            int           // timeout in seconds for each requests
-	DisableCompression bool          // do not decompress gzipped content
-	DisableKeepAlive   bool          // keepalive the connection
-	results            [][]*result
+	Shooter            IShooter             // requests shooter
+	Duration           time.Duration        // time for attacking
+	Concurrency        int                  // go routines count
+	Period             int                  // index of the period, labels per-second statistics
+	Timeout            int                  // timeout in seconds for each requests
+	DisableCompression bool                 // do not decompress gzipped content
+	DisableKeepAlive   bool                 // keepalive the connection
+	Checker            *ResponseChecker     // response assertions, nil for none
+	Breaker            *CircuitBreaker      // abort rules, nil for none
+	Series             *TimeSeriesCollector // per-second statistics, nil for none
+	Exporter           *JobMetrics          // prometheus metrics, nil for none
+	workers            []*workerStats
+}
+
+type workerStats struct {
+	// results of one worker aggregated on the fly, or of one agent in distributed runs
+	requests       int
+	success        int
+	latencies      *Histogram // merged into the report once the period ends
+	statusCodeDist map[string]int
+	errorDist      map[string]int
 }
 
-func (b *Boomer) Run() *Report {
-	b.results = make([][]*result, b.Concurrency)
+func newWorkerStats() *workerStats {
+	return &workerStats{
+		latencies:      NewHistogram(),
+		statusCodeDist: make(map[string]int),
+		errorDist:      make(map[string]int),
+	}
+}
+
+func (s *workerStats) add(res *result) {
+	if res.err != nil {
+		s.errorDist[strings.Replace(res.err.Error(), ".", ":", -1)]++
+	}
+	if res.statusCode != 0 {
+		// responses failing assertions still count in latencies
+		s.latencies.Record(res.duration)
+		s.statusCodeDist[strconv.Itoa(res.statusCode)]++
+	}
+	if res.err == nil {
+		s.success++
+	}
+	s.requests++
+}
+
+func (b *Boomer) Run(ctx context.Context) *Report {
+	// attack for Duration or until ctx is cancelled
+	ctx, cancel := context.WithTimeout(ctx, b.Duration)
+	defer cancel()
+	b.workers = make([]*workerStats, b.Concurrency)
+	for i := range b.workers {
+		b.workers[i] = newWorkerStats()
+	}
 	s := time.Now()
-	b.runWorkers()
-	var report = newReport(b.results, b.Concurrency, time.Now().Sub(s))
+	b.runWorkers(ctx)
+	var report = newReport(b.workers, b.Concurrency, time.Now().Sub(s))
 	report.finalize()
 	return report
 }
 
-func (b *Boomer) makeRequest(c *http.Client, i int) {
+func (b *Boomer) makeRequest(ctx context.Context, c *http.Client, i int) {
 	s := time.Now()
 	var code int
-	resp, err := c.Do(b.Shooter.Next())
+	var body []byte
+	var reqCtx = ctx
+	if b.Timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, time.Duration(b.Timeout)*time.Second)
+		defer cancel()
+	}
+	resp, err := c.Do(b.Shooter.Next().WithContext(reqCtx))
 	if err == nil {
 		code = resp.StatusCode
-		io.Copy(ioutil.Discard, resp.Body)
+		if b.Checker != nil && b.Checker.NeedBody() {
+			body, err = ioutil.ReadAll(resp.Body)
+		} else {
+			_, err = io.Copy(ioutil.Discard, resp.Body)
+		}
 		resp.Body.Close()
 	}
+	var duration = time.Now().Sub(s)
+	if err != nil && ctx.Err() != nil {
+		// interrupted by the end of attack, not a failure of target
+		return
+	}
+	if err != nil && reqCtx.Err() == context.DeadlineExceeded {
+		err = errRequestTimeout
+	}
+	if err == nil && b.Checker != nil {
+		err = b.Checker.Check(code, body)
+	}
+	if b.Breaker != nil {
+		b.Breaker.Record(time.Now(), duration, err != nil)
+	}
+	if b.Series != nil {
+		b.Series.Record(time.Now(), b.Period, duration, code, err == nil)
+	}
+	if b.Exporter != nil {
+		b.Exporter.Observe(duration, err == nil)
+	}
 	var res = result{
 		statusCode: code,
-		duration:   time.Now().Sub(s),
+		duration:   duration,
 		err:        err,
 	}
-	b.results[i] = append(b.results[i], &res)
+	b.workers[i].add(&res)
 }
 
-func (b *Boomer) runWorker(i int) {
+func (b *Boomer) runWorker(ctx context.Context, i int) {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
 		DisableCompression:  b.DisableCompression,
 		DisableKeepAlives:   b.DisableKeepAlive,
-		TLSHandshakeTimeout: time.Duration(b.Timeout) * time.Millisecond,
+		TLSHandshakeTimeout: time.Duration(b.Timeout) * time.Second,
 	}
 	client := &http.Client{Transport: tr}
-	start := time.Now()
-	b.results[i] = []*result{}
-	for {
-		if time.Now().Sub(start) > b.Duration {
-			break
-		}
-		b.makeRequest(client, i)
+	for ctx.Err() == nil {
+		b.makeRequest(ctx, client, i)
 	}
 }
 
-func (b *Boomer) runWorkers() {
+func (b *Boomer) runWorkers(ctx context.Context) {
 	// run attacker
 	var wg sync.WaitGroup
 	wg.Add(b.Concurrency)
 	for i := 0; i < b.Concurrency; i++ {
 		go func(k int) {
-			b.runWorker(k)
+			b.runWorker(ctx, k)
 			wg.Done()
 		}(i)
 	}
@@ -118,34 +190,30 @@ func (b *Boomer) runWorkers() {
 }
 
 type Report struct {
-	Latency        time.Duration  // average latency
-	Latency_P99    time.Duration  // p99 latency
-	Latency_P95    time.Duration  // p95 latency
-	Qps            float64        // qps
-	Concurrency    int            // go routines count
-	Requests       int            // total requests sent
-	SuccessRatio   float64        // success ratio
-	Duration       time.Duration  // time for attacking
-	ErrorDist      map[string]int // error map
-	StatusCodeDist map[string]int // status codes map
-
-	avgTotal  float64
-	results   [][]*result
-	latencies *quantile.Estimator
+	Latency        time.Duration       // average latency
+	Latency_P99    time.Duration       // p99 latency
+	Latency_P95    time.Duration       // p95 latency
+	Qps            float64             // qps
+	Concurrency    int                 // go routines count
+	Requests       int                 // total requests sent
+	SuccessRatio   float64             // success ratio
+	Duration       time.Duration       // time for attacking
+	ErrorDist      map[string]int      // error map
+	StatusCodeDist map[string]int      // status codes map
+	Percentiles    *LatencyPercentiles // latency distribution, nil without responses
+
+	workers   []*workerStats
+	latencies *Histogram
 }
 
-func newReport(results [][]*result, concurrency int, duration time.Duration) *Report {
+func newReport(workers []*workerStats, concurrency int, duration time.Duration) *Report {
 	return &Report{
-		results:        results,
+		workers:        workers,
 		Concurrency:    concurrency,
 		Duration:       duration,
 		StatusCodeDist: make(map[string]int),
 		ErrorDist:      make(map[string]int),
-		latencies: quantile.New(
-			quantile.Known(0.50, 0.01),
-			quantile.Known(0.95, 0.001),
-			quantile.Known(0.99, 0.0005),
-		),
+		latencies:      NewHistogram(),
 	}
 }
 
@@ -153,23 +221,29 @@ func (r *Report) finalize() {
 	// 汇总报告
 	var total = 0
 	var success = 0
-	for _, wresults := range r.results {
-		for _, res := range wresults {
-			if res.err != nil {
-				r.ErrorDist[strings.Replace(res.err.Error(), ".", ":", -1)]++
-			} else {
-				r.latencies.Add(res.duration.Seconds())
-				r.avgTotal += res.duration.Seconds()
-				r.StatusCodeDist[fmt.Sprintf("%v", res.statusCode)]++
-				success++
-			}
-			total++
+	for _, stats := range r.workers {
+		for k, n := range stats.errorDist {
+			r.ErrorDist[k] += n
 		}
+		for k, n := range stats.statusCodeDist {
+			r.StatusCodeDist[k] += n
+		}
+		r.latencies.Merge(stats.latencies)
+		success += stats.success
+		total += stats.requests
 	}
-	r.Qps = float64(r.latencies.Samples()) / r.Duration.Seconds()
-	r.Latency = time.Duration(r.avgTotal*1000/float64(r.latencies.Samples())) * time.Millisecond
-	r.Latency_P99 = time.Duration(r.latencies.Get(0.99)*1000) * time.Millisecond
-	r.Latency_P95 = time.Duration(r.latencies.Get(0.95)*1000) * time.Millisecond
 	r.Requests = total
+	if total == 0 {
+		// attack cancelled before any request finished
+		return
+	}
 	r.SuccessRatio = float64(success) * 100 / float64(total)
+	if r.latencies.Total == 0 {
+		return
+	}
+	r.Qps = float64(r.latencies.Total) / r.Duration.Seconds()
+	r.Latency = r.latencies.Mean()
+	r.Latency_P99 = r.latencies.Quantile(0.99)
+	r.Latency_P95 = r.latencies.Quantile(0.95)
+	r.Percentiles = r.latencies.Percentiles()
 }
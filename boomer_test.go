@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSlowBoomer(server *httptest.Server, duration time.Duration) *Boomer {
+	var job = NewBoomJob("slow", "", "")
+	job.Url = "/slow"
+	job.Hosts = []string{strings.TrimPrefix(server.URL, "http://")}
+	return &Boomer{
+		Shooter:     NewRandomBoomShooter(job),
+		Duration:    duration,
+		Concurrency: 2,
+		Timeout:     1,
+	}
+}
+
+func Test_BoomerRequestTimeout(t *testing.T) {
+	var release = make(chan bool)
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(3 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var report = newSlowBoomer(server, 1500*time.Millisecond).Run(context.Background())
+	if report.ErrorDist[errRequestTimeout.Error()] != 2 || report.Requests != 2 {
+		t.Errorf("requests over 1s should time out, got %v", report.ErrorDist)
+	}
+}
+
+func Test_BoomerCancel(t *testing.T) {
+	var release = make(chan bool)
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(3 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	var start = time.Now()
+	var report = newSlowBoomer(server, 10*time.Second).Run(ctx)
+	if elapsed := time.Now().Sub(start); elapsed > time.Second {
+		t.Errorf("cancelled attack should return at once, took %v", elapsed)
+	}
+	if report.Requests != 0 || len(report.ErrorDist) != 0 {
+		t.Errorf("interrupted requests should not be counted, got %d %v", report.Requests, report.ErrorDist)
+	}
+}
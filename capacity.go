@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+// Max sustainable qps search for vegeta jobs
+
+type RatePlanner interface {
+	// next qps step judged by metrics of the previous one, false when finished
+	Next(previous *vegeta.Metrics) (RatePeriod, bool)
+}
+
+type StaticRatePlanner struct {
+	// qps steps configured by job
+	Periods []RatePeriod
+	index   int
+}
+
+func (p *StaticRatePlanner) Next(previous *vegeta.Metrics) (RatePeriod, bool) {
+	if p.index >= len(p.Periods) {
+		return RatePeriod{}, false
+	}
+	p.index++
+	return p.Periods[p.index-1], true
+}
+
+type CapacitySearch struct {
+	// search qps range in binary steps until SLO boundary is narrower than Precision
+	MinRate   uint64
+	MaxRate   uint64
+	Precision uint64
+	// seconds for each probe
+	Duration uint
+	// probe passes when SLO holds
+	Slo Thresholds
+}
+
+func (s *CapacitySearch) Validate(errs FieldErrors) {
+	if s.MinRate == 0 || s.MaxRate <= s.MinRate {
+		errs.Add("Search", "rate range must be positive and increasing")
+	}
+	if s.Precision == 0 || s.Duration == 0 {
+		errs.Add("Search", "precision and duration must be positive")
+	}
+	if s.Slo.IsEmpty() {
+		errs.Add("Search", "slo is required")
+	}
+	s.Slo.Validate(errs)
+}
+
+type CapacityProbe struct {
+	Rate    uint64
+	Passed  bool
+	Verdict *Verdict
+}
+
+type CapacityResult struct {
+	// max probed rate meeting SLO, 0 when even MinRate breaks it
+	Rate   uint64
+	Probes []*CapacityProbe
+}
+
+type CapacitySearcher struct {
+	search  CapacitySearch
+	low     uint64 // highest passed rate
+	high    uint64 // lowest failed rate
+	current uint64
+	probes  []*CapacityProbe
+}
+
+func NewCapacitySearcher(search CapacitySearch) *CapacitySearcher {
+	return &CapacitySearcher{search: search}
+}
+
+func (s *CapacitySearcher) Next(previous *vegeta.Metrics) (RatePeriod, bool) {
+	// probe MinRate and MaxRate first, then bisect between passed and failed rates
+	if previous != nil {
+		var verdict = s.search.Slo.CheckVegeta(previous)
+		s.probes = append(s.probes, &CapacityProbe{s.current, verdict.Passed, verdict})
+		if verdict.Passed {
+			s.low = s.current
+		} else {
+			s.high = s.current
+		}
+	}
+	switch {
+	case len(s.probes) == 0:
+		s.current = s.search.MinRate
+	case s.low == 0:
+		return RatePeriod{}, false
+	case len(s.probes) == 1:
+		s.current = s.search.MaxRate
+	case s.high == 0 || s.high-s.low <= s.search.Precision:
+		return RatePeriod{}, false
+	default:
+		s.current = (s.low + s.high) / 2
+	}
+	return RatePeriod{s.current, s.search.Duration}, true
+}
+
+func (s *CapacitySearcher) Result() *CapacityResult {
+	return &CapacityResult{Rate: s.low, Probes: s.probes}
+}
+
+func NewVegetaPlanner(job *VegetaJob) RatePlanner {
+	if job.Search != nil {
+		return NewCapacitySearcher(*job.Search)
+	}
+	return &StaticRatePlanner{Periods: job.Periods}
+}
+
+func ParseCapacitySearchForm(req *http.Request) *CapacitySearch {
+	// read search settings from run form
+	var search = &CapacitySearch{}
+	var minRate, _ = strconv.Atoi(req.FormValue("min_rate"))
+	var maxRate, _ = strconv.Atoi(req.FormValue("max_rate"))
+	var precision, _ = strconv.Atoi(req.FormValue("precision"))
+	var duration, _ = strconv.Atoi(req.FormValue("probe_duration"))
+	search.MinRate = uint64(minRate)
+	search.MaxRate = uint64(maxRate)
+	search.Precision = uint64(precision)
+	search.Duration = uint(duration)
+	search.Slo.MaxP99Latency, _ = strconv.ParseFloat(req.FormValue("slo_p99_latency"), 64)
+	search.Slo.MinSuccessRatio, _ = strconv.ParseFloat(req.FormValue("slo_success_ratio"), 64)
+	return search
+}
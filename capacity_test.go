@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+func Test_CapacitySearcher(t *testing.T) {
+	// fake target sustaining 370 qps within 100ms p99
+	var searcher = NewCapacitySearcher(CapacitySearch{MinRate: 100, MaxRate: 1000, Precision: 20, Duration: 1, Slo: Thresholds{MaxP99Latency: 100}})
+	var rates []uint64
+	var previous *vegeta.Metrics
+	for {
+		period, ok := searcher.Next(previous)
+		if !ok {
+			break
+		}
+		rates = append(rates, period.Rate)
+		previous = &vegeta.Metrics{Rate: float64(period.Rate)}
+		previous.Latencies.P99 = 50 * time.Millisecond
+		if period.Rate > 370 {
+			previous.Latencies.P99 = 500 * time.Millisecond
+		}
+	}
+	var result = searcher.Result()
+	if result.Rate < 350 || result.Rate > 370 || len(result.Probes) != len(rates) {
+		t.Errorf("capacity should be found within precision, got %d after %v", result.Rate, rates)
+	}
+	if rates[0] != 100 || rates[1] != 1000 || len(rates) > 8 {
+		t.Errorf("search should probe range bounds then bisect, got %v", rates)
+	}
+
+	searcher = NewCapacitySearcher(CapacitySearch{MinRate: 100, MaxRate: 1000, Precision: 20, Duration: 1, Slo: Thresholds{MaxP99Latency: 1}})
+	period, _ := searcher.Next(nil)
+	previous = &vegeta.Metrics{Rate: float64(period.Rate)}
+	previous.Latencies.P99 = time.Second
+	if _, ok := searcher.Next(previous); ok || searcher.Result().Rate != 0 {
+		t.Errorf("search should stop when min rate breaks slo")
+	}
+}
+
+func Test_ApiVegetaCapacitySearch(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job = NewVegetaJob("capacity", "go", "alex")
+	job.Url = "/ping"
+	job.Hosts = []string{target.Host()}
+	job.Workers = 2
+	G_Store.InsertVegetaJob(job)
+	var jobId = job.Id.Hex()
+
+	var code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs/"+jobId+"/run", map[string]interface{}{
+		"Search": map[string]interface{}{"MinRate": 10, "MaxRate": 5},
+	}, nil)
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid search should be rejected, got %d", code)
+	}
+	var lg AttackVegetaLog
+	code = doJsonRequest(h, "POST", "/api/v1/vegeta/jobs/"+jobId+"/run", map[string]interface{}{
+		"Search": map[string]interface{}{"MinRate": 10, "MaxRate": 20, "Precision": 10, "Duration": 1, "Slo": map[string]interface{}{"MinSuccessRatio": 90}},
+	}, &lg)
+	if code != http.StatusAccepted {
+		t.Fatalf("search should be accepted, got %d", code)
+	}
+	waitJobDone(t, G_RunningVegetaJobs, jobId)
+	doJsonRequest(h, "GET", "/api/v1/vegeta/logs/"+lg.Id.Hex(), nil, &lg)
+	if lg.Capacity == nil || lg.Capacity.Rate != 20 || len(lg.MetricsList) != 2 || len(lg.Periods) != 2 || lg.Periods[1].Rate != 20 {
+		t.Errorf("healthy target should sustain max rate, got %v %v", lg.Capacity, lg.Periods)
+	}
+	if w := doRequest(h, "GET", "/vegeta/metrics", map[string][]string{"log_id": {lg.Id.Hex()}}); w.Code != 200 {
+		t.Errorf("metrics page should render, got %d", w.Code)
+	}
+	if w := doRequest(h, "GET", "/vegeta/run", map[string][]string{"job_id": {jobId}}); w.Code != 200 {
+		t.Errorf("run page should render last search settings, got %d", w.Code)
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Command line client talking to a running Alex server through /api/v1
+
+var G_Commands = map[string]func(args []string) int{
+	"job":    JobCommand,
+	"report": ReportCommand,
+}
+
+// Exit codes of command line client
+const (
+	ExitOk      = 0
+	ExitFailure = 1 // attack did not finish successfully
+	ExitError   = 2 // usage or server errors
+)
+
+func IsCommand(name string) bool {
+	_, ok := G_Commands[name]
+	return ok
+}
+
+func RunCommand(args []string) int {
+	return G_Commands[args[0]](args[1:])
+}
+
+func commandUsage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  alex job list [-engine vegeta|boom] [-team team] [-project project]
+  alex job run <job_id> [-engine vegeta|boom] [-comment text] [-wait]
+  alex report show <log_id> [-engine vegeta|boom] [-format text|json|csv|seconds|junit]
+every command accepts -server http://host:port, defaults to $ALEX_SERVER`)
+}
+
+// Parse flags placed before or after positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func defaultServer() string {
+	if server := os.Getenv("ALEX_SERVER"); server != "" {
+		return server
+	}
+	return "http://localhost:8000"
+}
+
+type ApiClient struct {
+	// json client of /api/v1
+	Server string
+	Header http.Header // sent with every call
+	client *http.Client
+}
+
+func NewApiClient(server string) *ApiClient {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	return &ApiClient{Server: strings.TrimRight(server, "/"), Header: http.Header{}, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+type ApiError struct {
+	Status  int
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("server returns %d: %s", e.Status, e.Message)
+}
+
+func (c *ApiClient) Call(method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.Server+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error  string
+			Fields FieldErrors `json:"fields"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		var message = failure.Error
+		for field, reasons := range failure.Fields {
+			for _, reason := range reasons {
+				message += fmt.Sprintf("; %s: %s", field, reason)
+			}
+		}
+		return &ApiError{resp.StatusCode, message}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*ApiError)
+	return ok && apiErr.Status == http.StatusNotFound
+}
+
+// Find the engine owning the job or log id when not given explicitly
+func (c *ApiClient) DetectEngine(kind string, id string) (string, error) {
+	for _, engine := range []string{"vegeta", "boom"} {
+		err := c.Call("GET", fmt.Sprintf("/%s/%s/%s", engine, kind, id), nil, nil)
+		if err == nil {
+			return engine, nil
+		}
+		if !isNotFound(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%s %s not found", strings.TrimSuffix(kind, "s"), id)
+}
+
+func checkEngine(engine string) error {
+	if engine != "" && engine != "vegeta" && engine != "boom" {
+		return errors.New("engine must be vegeta or boom")
+	}
+	return nil
+}
+
+func checkFormat(format string) error {
+	if _, ok := exportFormats[format]; !ok && format != "text" {
+		return errors.New("format must be text, json, csv, seconds or junit")
+	}
+	return nil
+}
+
+func JobCommand(args []string) int {
+	if len(args) == 0 {
+		commandUsage()
+		return ExitError
+	}
+	switch args[0] {
+	case "list":
+		return jobListCommand(args[1:])
+	case "run":
+		return jobRunCommand(args[1:])
+	}
+	commandUsage()
+	return ExitError
+}
+
+func jobListCommand(args []string) int {
+	var fs = flag.NewFlagSet("job list", flag.ContinueOnError)
+	var server = fs.String("server", defaultServer(), "alex server address")
+	var engine = fs.String("engine", "", "vegeta or boom, both engines by default")
+	var team = fs.String("team", "", "filter by team")
+	var project = fs.String("project", "", "filter by project")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitError
+	}
+	if err := checkEngine(*engine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	var client = NewApiClient(*server)
+	var w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENGINE\tID\tNAME\tTEAM\tPROJECT\tURL\tSTATE\tLAST RUN")
+	for _, e := range []string{"vegeta", "boom"} {
+		if *engine != "" && *engine != e {
+			continue
+		}
+		jobs, err := listJobs(client, e, url.Values{"team": {*team}, "project": {*project}})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		for _, job := range jobs {
+			var state = "Quiet"
+			if job.Running {
+				state = "Running"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e, job.Id, job.Name, job.Team, job.Project, job.Url, state, Strftime(job.LastRunTs))
+		}
+	}
+	w.Flush()
+	return ExitOk
+}
+
+type jobListItem struct {
+	Id        string `json:"id"`
+	Name      string
+	Team      string
+	Project   string
+	Url       string
+	LastRunTs int64
+	Running   bool
+}
+
+func listJobs(client *ApiClient, engine string, query url.Values) ([]jobListItem, error) {
+	// the api returns one page at a time, fetch pages until all jobs are read
+	var jobs []jobListItem
+	for p := 0; ; p++ {
+		var page struct {
+			Total int `json:"total"`
+			Jobs  []jobListItem
+		}
+		query.Set("p", strconv.Itoa(p))
+		var path = fmt.Sprintf("/%s/jobs?%s", engine, query.Encode())
+		if err := client.Call("GET", path, nil, &page); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, page.Jobs...)
+		if len(page.Jobs) == 0 || len(jobs) >= page.Total {
+			return jobs, nil
+		}
+	}
+}
+
+func jobRunCommand(args []string) int {
+	var fs = flag.NewFlagSet("job run", flag.ContinueOnError)
+	var server = fs.String("server", defaultServer(), "alex server address")
+	var engine = fs.String("engine", "", "vegeta or boom, detected by default")
+	var comment = fs.String("comment", "run from command line", "comment of the attack log")
+	var wait = fs.Bool("wait", false, "wait until the attack ends and print the report")
+	var interval = fs.Duration("interval", 2*time.Second, "polling interval while waiting")
+	var format = fs.String("format", "text", "report format after waiting, text, json, csv, seconds or junit")
+	ids, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitError
+	}
+	if len(ids) != 1 {
+		commandUsage()
+		return ExitError
+	}
+	if err := checkEngine(*engine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	if err := checkFormat(*format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	var client = NewApiClient(*server)
+	if *engine == "" {
+		*engine, err = client.DetectEngine("jobs", ids[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+	}
+	var lg struct {
+		Id string `json:"id"`
+	}
+	var path = fmt.Sprintf("/%s/jobs/%s/run", *engine, ids[0])
+	err = client.Call("POST", path, map[string]string{"Comment": *comment}, &lg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	fmt.Fprintf(os.Stderr, "attack started, log id %s\n", lg.Id)
+	if !*wait {
+		fmt.Println(lg.Id)
+		return ExitOk
+	}
+	return waitReport(client, *engine, lg.Id, *interval, *format)
+}
+
+func waitReport(client *ApiClient, engine string, logId string, interval time.Duration, format string) int {
+	// poll the attack log until it leaves Running state
+	for {
+		var lg struct {
+			State string
+		}
+		err := client.Call("GET", fmt.Sprintf("/%s/logs/%s", engine, logId), nil, &lg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		if lg.State != "Running" {
+			return showReport(client, engine, logId, format)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func ReportCommand(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		commandUsage()
+		return ExitError
+	}
+	var fs = flag.NewFlagSet("report show", flag.ContinueOnError)
+	var server = fs.String("server", defaultServer(), "alex server address")
+	var engine = fs.String("engine", "", "vegeta or boom, detected by default")
+	var format = fs.String("format", "text", "text, json, csv, seconds or junit")
+	ids, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return ExitError
+	}
+	if len(ids) != 1 {
+		commandUsage()
+		return ExitError
+	}
+	if err := checkEngine(*engine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	if err := checkFormat(*format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	var client = NewApiClient(*server)
+	if *engine == "" {
+		*engine, err = client.DetectEngine("logs", ids[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+	}
+	return showReport(client, *engine, ids[0], *format)
+}
+
+func showReport(client *ApiClient, engine string, logId string, format string) int {
+	var path = fmt.Sprintf("/%s/logs/%s", engine, logId)
+	var raw json.RawMessage
+	err := client.Call("GET", path, nil, &raw)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	var state string
+	var verdict *Verdict
+	var export *ReportExport
+	if engine == "vegeta" {
+		var lg AttackVegetaLog
+		err = json.Unmarshal(raw, &lg)
+		if err == nil && format == "text" {
+			PrintVegetaReport(os.Stdout, &lg)
+		}
+		state = lg.State
+		verdict = lg.Verdict
+		export = NewVegetaExport(&lg)
+	} else {
+		var lg AttackBoomLog
+		err = json.Unmarshal(raw, &lg)
+		if err == nil && format == "text" {
+			PrintBoomReport(os.Stdout, &lg)
+		}
+		state = lg.State
+		verdict = lg.Verdict
+		export = NewBoomExport(&lg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	if _, ok := exportFormats[format]; ok && format != "json" {
+		if err := export.Write(os.Stdout, format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+	}
+	if format == "json" {
+		var buffer bytes.Buffer
+		json.Indent(&buffer, raw, "", "  ")
+		buffer.WriteString("\n")
+		buffer.WriteTo(os.Stdout)
+	}
+	if state != "End" || (verdict != nil && !verdict.Passed) {
+		return ExitFailure
+	}
+	return ExitOk
+}
+
+func PrintVegetaReport(out io.Writer, lg *AttackVegetaLog) {
+	fmt.Fprintf(out, "Job: %s %s\nLog: %s [%s] %s\n\n", lg.JobName, lg.JobUrl, lg.Id.Hex(), lg.State, lg.Comment)
+	var w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "QPS\tDURATION\tREQUESTS\tSUCCESS\tMEAN\tP95\tP99\tERRORS")
+	for _, metrics := range lg.MetricsList {
+		fmt.Fprintf(w, "%.2f\t%v\t%d\t%.2f%%\t%v\t%v\t%v\t%d\n",
+			metrics.Rate, metrics.Duration, metrics.Requests, metrics.Success*100,
+			metrics.Latencies.Mean, metrics.Latencies.P95, metrics.Latencies.P99, VegetaErrorCount(metrics))
+	}
+	w.Flush()
+	printAbortReason(out, lg.AbortReason)
+	printVerdict(out, lg.Verdict)
+	if lg.Capacity != nil {
+		fmt.Fprintf(out, "\nMax sustainable QPS: %d\n", lg.Capacity.Rate)
+	}
+}
+
+func PrintBoomReport(out io.Writer, lg *AttackBoomLog) {
+	fmt.Fprintf(out, "Job: %s %s\nLog: %s [%s] %s\n\n", lg.JobName, lg.JobUrl, lg.Id.Hex(), lg.State, lg.Comment)
+	var w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CONCURRENCY\tDURATION\tREQUESTS\tQPS\tSUCCESS\tMEAN\tP95\tP99\tERRORS")
+	for _, report := range lg.MetricsList {
+		fmt.Fprintf(w, "%d\t%v\t%d\t%.2f\t%.2f%%\t%v\t%v\t%v\t%d\n",
+			report.Concurrency, report.Duration, report.Requests, report.Qps, report.SuccessRatio,
+			report.Latency, report.Latency_P95, report.Latency_P99, BoomErrorCount(report))
+	}
+	w.Flush()
+	printAbortReason(out, lg.AbortReason)
+	printVerdict(out, lg.Verdict)
+}
+
+func printAbortReason(out io.Writer, reason string) {
+	if reason == "" {
+		return
+	}
+	fmt.Fprintf(out, "\nAborted: %s\n", reason)
+}
+
+func printVerdict(out io.Writer, verdict *Verdict) {
+	if verdict == nil {
+		return
+	}
+	fmt.Fprintf(out, "\nVerdict: %s\n", verdict)
+}
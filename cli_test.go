@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_ParseArgs(t *testing.T) {
+	var fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	var wait = fs.Bool("wait", false, "")
+	var format = fs.String("format", "text", "")
+	positional, err := parseArgs(fs, []string{"-format", "json", "abc", "--wait"})
+	if err != nil || len(positional) != 1 || positional[0] != "abc" || !*wait || *format != "json" {
+		t.Errorf("flags after positional arguments should be parsed, got %v %v %v %v", positional, *wait, *format, err)
+	}
+}
+
+func Test_CommandJobRunWait(t *testing.T) {
+	var server = httptest.NewServer(setupTestServer())
+	defer server.Close()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job = NewVegetaJob("cli", "go", "alex")
+	job.Url = "/ping"
+	job.Hosts = []string{target.Host()}
+	job.Workers = 2
+	job.Periods = []RatePeriod{{10, 1}}
+	G_Store.InsertVegetaJob(job)
+
+	if code := RunCommand([]string{"job", "list", "-server", server.URL}); code != ExitOk {
+		t.Errorf("job list should succeed, got %d", code)
+	}
+	var code = RunCommand([]string{"job", "run", job.Id.Hex(), "--wait", "-interval", "100ms", "-server", server.URL})
+	if code != ExitOk {
+		t.Errorf("finished job should exit ok, got %d", code)
+	}
+	logs, _ := G_Store.FindVegetaLogs(LogCondition{JobId: job.Id.Hex()}, 0, 0)
+	if len(logs) != 1 || logs[0].State != "End" {
+		t.Fatalf("job should be attacked once, got %v", logs)
+	}
+	if code = RunCommand([]string{"report", "show", logs[0].Id.Hex(), "-format", "json", "-server", server.URL}); code != ExitOk {
+		t.Errorf("report show should succeed, got %d", code)
+	}
+	if code = RunCommand([]string{"report", "show", logs[0].Id.Hex(), "-format", "junit", "-server", server.URL}); code != ExitOk {
+		t.Errorf("report show as junit should succeed, got %d", code)
+	}
+	if code = RunCommand([]string{"report", "show", logs[0].Id.Hex(), "-format", "pdf", "-server", server.URL}); code != ExitError {
+		t.Errorf("unknown format should fail, got %d", code)
+	}
+	if code = RunCommand([]string{"report", "show", "unknown", "-server", server.URL}); code != ExitError {
+		t.Errorf("unknown report should fail, got %d", code)
+	}
+}
+
+func Test_CommandJobListPages(t *testing.T) {
+	var server = httptest.NewServer(setupTestServer())
+	defer server.Close()
+	for i := 0; i < 45; i++ {
+		G_Store.InsertBoomJob(NewBoomJob("cli", "go", "alex"))
+	}
+	G_Store.InsertBoomJob(NewBoomJob("cli", "java", "alex"))
+	jobs, err := listJobs(NewApiClient(server.URL), "boom", url.Values{"team": {"go"}})
+	if err != nil || len(jobs) != 45 {
+		t.Errorf("jobs of every page should be listed, got %d %v", len(jobs), err)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Compare attack logs of the same job period by period
+
+var ErrTooFewLogs = errors.New("at least two logs are required")
+var ErrMixedJobs = errors.New("logs belong to different jobs")
+
+type PeriodStats struct {
+	// comparable numbers of one period, latencies in milliseconds
+	Step         float64 // rate for vegeta, concurrency for boom
+	Qps          float64
+	Mean         float64
+	P95          float64
+	P99          float64
+	SuccessRatio float64 // percent
+	Requests     int
+}
+
+type Delta struct {
+	// change against the first log, Worse marks a regression
+	Diff    float64
+	Percent float64
+	Worse   bool
+}
+
+func NewDelta(base float64, value float64, lowerIsBetter bool) *Delta {
+	var delta = &Delta{Diff: value - base}
+	if base != 0 {
+		delta.Percent = delta.Diff * 100 / math.Abs(base)
+	}
+	if lowerIsBetter {
+		delta.Worse = delta.Diff > 0
+	} else {
+		delta.Worse = delta.Diff < 0
+	}
+	return delta
+}
+
+func (d *Delta) String() string {
+	return fmt.Sprintf("%+.2f (%+.1f%%)", d.Diff, d.Percent)
+}
+
+type StatsDelta struct {
+	Qps          *Delta
+	Mean         *Delta
+	P95          *Delta
+	P99          *Delta
+	SuccessRatio *Delta
+}
+
+func NewStatsDelta(base *PeriodStats, stats *PeriodStats) *StatsDelta {
+	return &StatsDelta{
+		Qps:          NewDelta(base.Qps, stats.Qps, false),
+		Mean:         NewDelta(base.Mean, stats.Mean, true),
+		P95:          NewDelta(base.P95, stats.P95, true),
+		P99:          NewDelta(base.P99, stats.P99, true),
+		SuccessRatio: NewDelta(base.SuccessRatio, stats.SuccessRatio, false),
+	}
+}
+
+type ComparedLog struct {
+	Id      string
+	Comment string
+	State   string
+	StartTs int64
+}
+
+type ComparedCell struct {
+	// nil Stats when the log has no such step, nil Delta for the first log
+	Stats *PeriodStats
+	Delta *StatsDelta
+}
+
+type ComparedPeriod struct {
+	Step  float64
+	Cells []*ComparedCell
+}
+
+type Comparison struct {
+	Engine   string
+	JobId    string
+	JobName  string
+	StepName string
+	Logs     []*ComparedLog
+	Periods  []*ComparedPeriod
+}
+
+func VegetaPeriodStats(lg *AttackVegetaLog) []*PeriodStats {
+	// step is the attacked rate, achieved rate for logs without settings
+	var statsList []*PeriodStats
+	for i, metrics := range lg.MetricsList {
+		var step = math.Floor(metrics.Rate + 0.5)
+		if i < len(lg.Periods) {
+			step = float64(lg.Periods[i].Rate)
+		} else if lg.JobDetail != nil && i < len(lg.JobDetail.Periods) {
+			step = float64(lg.JobDetail.Periods[i].Rate)
+		}
+		statsList = append(statsList, &PeriodStats{
+			Step:         step,
+			Qps:          metrics.Rate,
+			Mean:         metrics.Latencies.Mean.Seconds() * 1000,
+			P95:          metrics.Latencies.P95.Seconds() * 1000,
+			P99:          metrics.Latencies.P99.Seconds() * 1000,
+			SuccessRatio: metrics.Success * 100,
+			Requests:     int(metrics.Requests),
+		})
+	}
+	return statsList
+}
+
+func BoomPeriodStats(lg *AttackBoomLog) []*PeriodStats {
+	var statsList []*PeriodStats
+	for _, report := range lg.MetricsList {
+		statsList = append(statsList, &PeriodStats{
+			Step:         float64(report.Concurrency),
+			Qps:          report.Qps,
+			Mean:         report.Latency.Seconds() * 1000,
+			P95:          report.Latency_P95.Seconds() * 1000,
+			P99:          report.Latency_P99.Seconds() * 1000,
+			SuccessRatio: report.SuccessRatio,
+			Requests:     report.Requests,
+		})
+	}
+	return statsList
+}
+
+func CompareVegetaLogs(logs []*AttackVegetaLog) (*Comparison, error) {
+	if len(logs) < 2 {
+		return nil, ErrTooFewLogs
+	}
+	var comparison = &Comparison{Engine: "vegeta", JobId: logs[0].JobId, JobName: logs[0].JobName, StepName: "QPS"}
+	var statsLists [][]*PeriodStats
+	for _, lg := range logs {
+		if lg.JobId != comparison.JobId {
+			return nil, ErrMixedJobs
+		}
+		comparison.Logs = append(comparison.Logs, &ComparedLog{lg.Id.Hex(), lg.Comment, lg.State, lg.StartTs})
+		statsLists = append(statsLists, VegetaPeriodStats(lg))
+	}
+	comparison.alignPeriods(statsLists)
+	return comparison, nil
+}
+
+func CompareBoomLogs(logs []*AttackBoomLog) (*Comparison, error) {
+	if len(logs) < 2 {
+		return nil, ErrTooFewLogs
+	}
+	var comparison = &Comparison{Engine: "boom", JobId: logs[0].JobId, JobName: logs[0].JobName, StepName: "Concurrency"}
+	var statsLists [][]*PeriodStats
+	for _, lg := range logs {
+		if lg.JobId != comparison.JobId {
+			return nil, ErrMixedJobs
+		}
+		comparison.Logs = append(comparison.Logs, &ComparedLog{lg.Id.Hex(), lg.Comment, lg.State, lg.StartTs})
+		statsLists = append(statsLists, BoomPeriodStats(lg))
+	}
+	comparison.alignPeriods(statsLists)
+	return comparison, nil
+}
+
+func (c *Comparison) alignPeriods(statsLists [][]*PeriodStats) {
+	// align by step, repeated steps of a log align by their occurrence
+	var index = make(map[string]*ComparedPeriod)
+	for i, statsList := range statsLists {
+		var occurrences = make(map[float64]int)
+		for _, stats := range statsList {
+			var key = fmt.Sprintf("%v#%d", stats.Step, occurrences[stats.Step])
+			occurrences[stats.Step]++
+			var period, ok = index[key]
+			if !ok {
+				period = &ComparedPeriod{Step: stats.Step, Cells: make([]*ComparedCell, len(statsLists))}
+				for k := range period.Cells {
+					period.Cells[k] = &ComparedCell{}
+				}
+				index[key] = period
+				c.Periods = append(c.Periods, period)
+			}
+			period.Cells[i].Stats = stats
+		}
+	}
+	for _, period := range c.Periods {
+		var base = period.Cells[0].Stats
+		if base == nil {
+			continue
+		}
+		for _, cell := range period.Cells[1:] {
+			if cell.Stats != nil {
+				cell.Delta = NewStatsDelta(base, cell.Stats)
+			}
+		}
+	}
+}
+
+func (c *Comparison) ChartLabels() string {
+	// dygraph csv header, one series for each log
+	var buffer bytes.Buffer
+	buffer.WriteString(c.StepName)
+	for i, lg := range c.Logs {
+		var comment = strings.Replace(lg.Comment, ",", " ", -1)
+		buffer.WriteString(fmt.Sprintf(",#%d %s", i, comment))
+	}
+	return buffer.String()
+}
+
+func (c *Comparison) ChartData(metric string) string {
+	// overlaid series of one metric sorted by step, missing steps left empty
+	var periods = make([]*ComparedPeriod, len(c.Periods))
+	copy(periods, c.Periods)
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].Step < periods[j].Step
+	})
+	var buffer bytes.Buffer
+	for _, period := range periods {
+		buffer.WriteString(fmt.Sprintf("%v", period.Step))
+		for _, cell := range period.Cells {
+			buffer.WriteString(",")
+			if cell.Stats != nil {
+				buffer.WriteString(fmt.Sprintf("%v", cell.Stats.Metric(metric)))
+			}
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.String()
+}
+
+func (s *PeriodStats) Metric(metric string) float64 {
+	switch metric {
+	case "qps":
+		return s.Qps
+	case "mean":
+		return s.Mean
+	case "p95":
+		return s.P95
+	case "p99":
+		return s.P99
+	case "success":
+		return s.SuccessRatio
+	}
+	return 0
+}
+
+func LoadVegetaLogs(ids []string) ([]*AttackVegetaLog, error) {
+	var logs []*AttackVegetaLog
+	for _, id := range ids {
+		lg, err := G_Store.GetVegetaLog(id)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, lg)
+	}
+	return logs, nil
+}
+
+func LoadBoomLogs(ids []string) ([]*AttackBoomLog, error) {
+	var logs []*AttackBoomLog
+	for _, id := range ids {
+		lg, err := G_Store.GetBoomLog(id)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, lg)
+	}
+	return logs, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func newBoomLogWithReports(jobId string, reports ...*Report) *AttackBoomLog {
+	return &AttackBoomLog{Id: bson.NewObjectId(), JobId: jobId, State: "End", MetricsList: reports}
+}
+
+func Test_CompareBoomLogs(t *testing.T) {
+	var base = newBoomLogWithReports("job",
+		&Report{Concurrency: 10, Qps: 100, Latency_P99: 100 * time.Millisecond, SuccessRatio: 100},
+		&Report{Concurrency: 20, Qps: 200, Latency_P99: 200 * time.Millisecond, SuccessRatio: 100})
+	var other = newBoomLogWithReports("job",
+		&Report{Concurrency: 20, Qps: 150, Latency_P99: 300 * time.Millisecond, SuccessRatio: 90},
+		&Report{Concurrency: 40, Qps: 300, Latency_P99: 400 * time.Millisecond, SuccessRatio: 80})
+	comparison, err := CompareBoomLogs([]*AttackBoomLog{base, other})
+	if err != nil || len(comparison.Periods) != 3 {
+		t.Fatalf("periods should be aligned by concurrency, got %v %v", comparison, err)
+	}
+	var aligned = comparison.Periods[1]
+	if aligned.Step != 20 || aligned.Cells[1].Delta == nil {
+		t.Fatalf("concurrency 20 should be compared, got %v", aligned)
+	}
+	var delta = aligned.Cells[1].Delta
+	if delta.Qps.Percent != -25 || !delta.Qps.Worse || delta.P99.Percent != 50 || !delta.P99.Worse {
+		t.Errorf("deltas should be relative to the base log, got %v %v", delta.Qps, delta.P99)
+	}
+	if comparison.Periods[0].Cells[1].Stats != nil || comparison.Periods[2].Cells[0].Stats != nil {
+		t.Errorf("steps missing in a log should stay empty")
+	}
+	if data := comparison.ChartData("p99"); data != "10,100,\n20,200,300\n40,,400\n" {
+		t.Errorf("chart data should be sorted by step, got %q", data)
+	}
+
+	if _, err = CompareBoomLogs([]*AttackBoomLog{base}); err != ErrTooFewLogs {
+		t.Errorf("single log should not be compared, got %v", err)
+	}
+	if _, err = CompareBoomLogs([]*AttackBoomLog{base, newBoomLogWithReports("other")}); err != ErrMixedJobs {
+		t.Errorf("logs of other jobs should not be compared, got %v", err)
+	}
+}
+
+func Test_CompareVegetaLogsApi(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job = NewVegetaJob("compare", "go", "alex")
+	job.Url = "/ping"
+	job.Hosts = []string{target.Host()}
+	job.Workers = 2
+	job.Periods = []RatePeriod{{10, 1}}
+	G_Store.InsertVegetaJob(job)
+	var ids = url.Values{}
+	for _, comment := range []string{"before", "after"} {
+		lg, err := StartVegetaJob(job, comment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitJobDone(t, G_RunningVegetaJobs, job.Id.Hex())
+		ids.Add("log_id", lg.Id.Hex())
+	}
+
+	var comparison Comparison
+	var code = doJsonRequest(h, "GET", "/api/v1/vegeta/compare?"+ids.Encode(), nil, &comparison)
+	if code != 200 || len(comparison.Logs) != 2 || len(comparison.Periods) != 1 || comparison.Periods[0].Cells[1].Delta == nil {
+		t.Errorf("logs should be compared, got %d %v", code, comparison)
+	}
+	if w := doRequest(h, "GET", "/vegeta/compare", ids); w.Code != 200 {
+		t.Errorf("comparison page should render, got %d", w.Code)
+	}
+	if code = doJsonRequest(h, "GET", "/api/v1/vegeta/compare?log_id="+ids["log_id"][0], nil, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("single log should be rejected, got %d", code)
+	}
+	if code = doJsonRequest(h, "GET", "/api/v1/vegeta/compare?log_id=unknown&log_id=unknown", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown logs should be 404, got %d", code)
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/martini-contrib/render"
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+// Master side of distributed attacks, agents attack and the master merges their results
+
+var agentExpiry = 3 * agentHeartbeat // agents not registering again are gone
+var agentStartLead = time.Second     // time for period commands to reach every agent
+var agentClockSamples = 3            // clock readings of each agent before a period, the fastest round trip wins
+
+// Returned when starting a distributed job without live agents
+var ErrNoAgents = errors.New("no agents registered")
+
+// header carrying the shared token of master and agents
+const agentTokenHeader = "X-Alex-Agent-Token"
+
+func validAgentToken(expected string, token string) bool {
+	// an unset token refuses everyone
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+func newAgentRequest(method string, url string, body io.Reader) (*http.Request, error) {
+	// request of the master to an agent
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(agentTokenHeader, G_AgentToken)
+	return req, nil
+}
+
+type AgentInfo struct {
+	Name    string
+	Address string // host:port the master dials
+	SeenAt  time.Time
+}
+
+type AgentRegistry struct {
+	// agents keyed by address
+	agents map[string]*AgentInfo
+	mutex  sync.Mutex
+}
+
+func NewAgentRegistry() *AgentRegistry {
+	return &AgentRegistry{agents: make(map[string]*AgentInfo)}
+}
+
+func (r *AgentRegistry) Register(name string, address string) *AgentInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var info = &AgentInfo{Name: name, Address: address, SeenAt: time.Now()}
+	r.agents[address] = info
+	return info
+}
+
+func (r *AgentRegistry) Live() []*AgentInfo {
+	// agents seen recently sorted by address, expired agents are forgotten
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var live = []*AgentInfo{}
+	for address, info := range r.agents {
+		if time.Since(info.SeenAt) > agentExpiry {
+			delete(r.agents, address)
+			continue
+		}
+		copied := *info
+		live = append(live, &copied)
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].Address < live[j].Address
+	})
+	return live
+}
+
+func (r *AgentRegistry) LiveAddresses() []string {
+	var addresses []string
+	for _, info := range r.Live() {
+		addresses = append(addresses, info.Address)
+	}
+	return addresses
+}
+
+func ApiRegisterAgent(req *http.Request, r render.Render) {
+	// agents post again every heartbeat to stay alive
+	if !validAgentToken(G_AgentToken, req.Header.Get(agentTokenHeader)) {
+		apiError(r, http.StatusForbidden, "agent token is not valid", nil)
+		return
+	}
+	var info AgentInfo
+	if err := decodeJsonBody(req, &info); err != nil {
+		apiError(r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if info.Address == "" {
+		apiError(r, http.StatusBadRequest, "agent is not valid", FieldErrors{"Address": {"address is required"}})
+		return
+	}
+	r.JSON(http.StatusOK, G_Agents.Register(info.Name, info.Address))
+}
+
+func ApiGetAgents(r render.Render) {
+	r.JSON(http.StatusOK, G_Agents.Live())
+}
+
+func SplitShare(total int, n int) []int {
+	// even shares, the first agents take the remainder
+	var shares = make([]int, n)
+	for i := range shares {
+		shares[i] = total / n
+		if i < total%n {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+type AgentPeriodStats struct {
+	// results of one agent in one period for the log
+	Agent     string
+	Period    int
+	Requests  int
+	Successes int
+	Mean      time.Duration
+	P99       time.Duration
+	Error     string
+	// agent clock minus master clock
+	ClockOffset time.Duration
+	// actual start minus scheduled start in master clock
+	StartSkew time.Duration
+}
+
+func (s *AgentPeriodStats) PeriodNumber() int {
+	// counted from 1 for display
+	return s.Period + 1
+}
+
+type AgentGroup struct {
+	// agents attacking together for one log, task id is the log id
+	TaskId string
+	Agents []string
+	Start  time.Time // attack start on the master, periods start whole seconds later
+	mutex  sync.Mutex
+	halted bool
+	reason string
+	stats  []*AgentPeriodStats
+	skews  []time.Duration
+	// stop requests still on their way
+	stopping sync.WaitGroup
+}
+
+func NewAgentGroup(taskId string, agents []string, start time.Time) *AgentGroup {
+	return &AgentGroup{TaskId: taskId, Agents: agents, Start: start}
+}
+
+func (g *AgentGroup) RunPeriod(command AgentPeriodCommand, timeout int, series *TimeSeriesCollector) []*AgentPeriodResult {
+	// split the load of command, start all agents at the same instant and wait for their results
+	if g.Halted() {
+		return nil
+	}
+	var results = make([]*AgentPeriodResult, len(g.Agents))
+	var clocks = make([]time.Duration, len(g.Agents))
+	var roundTrip time.Duration
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	// barrier, the start is scheduled once every agent answered its clock
+	for i, address := range g.Agents {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			offset, rtt, err := MeasureClock(address)
+			if err != nil {
+				results[i] = &AgentPeriodResult{Agent: address, Error: err.Error()}
+				g.halt(fmt.Sprintf("agent %s failed: %v", address, err))
+				return
+			}
+			clocks[i] = offset
+			mutex.Lock()
+			if rtt > roundTrip {
+				roundTrip = rtt
+			}
+			mutex.Unlock()
+		}(i, address)
+	}
+	wg.Wait()
+	var offset = int((time.Since(g.Start) + agentStartLead + roundTrip + time.Second - 1) / time.Second)
+	var startAt = g.Start.Add(time.Duration(offset) * time.Second)
+	command.TaskId = g.TaskId
+	var rates = SplitShare(int(command.Rate), len(g.Agents))
+	var concurrencies = SplitShare(command.Concurrency, len(g.Agents))
+	for i, address := range g.Agents {
+		if results[i] != nil {
+			continue
+		}
+		if g.Halted() {
+			results[i] = &AgentPeriodResult{Agent: address}
+			continue
+		}
+		var share = command
+		share.Rate = uint64(rates[i])
+		share.Concurrency = concurrencies[i]
+		share.StartAt = startAt.Add(clocks[i])
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			var deadline = time.Until(startAt) + time.Duration(int(share.Duration)+timeout)*time.Second + 10*time.Second
+			result, err := g.post(address, &share, deadline)
+			if err != nil {
+				result = &AgentPeriodResult{Error: err.Error()}
+				g.halt(fmt.Sprintf("agent %s failed: %v", address, err))
+			} else if result.Error != "" {
+				g.halt(fmt.Sprintf("agent %s failed: %s", address, result.Error))
+			} else if result.AbortReason != "" {
+				g.halt(fmt.Sprintf("agent %s: %s", address, result.AbortReason))
+			}
+			result.Agent = address
+			results[i] = result
+		}(i, address)
+	}
+	wg.Wait()
+	var lists []TimeSeries
+	var earliest, latest time.Duration
+	var started = 0
+	for i, result := range results {
+		lists = append(lists, result.Series)
+		var skew time.Duration
+		if !result.StartedAt.IsZero() {
+			// actual start converted to master clock
+			skew = result.StartedAt.Add(-clocks[i]).Sub(startAt)
+			if started == 0 || skew < earliest {
+				earliest = skew
+			}
+			if started == 0 || skew > latest {
+				latest = skew
+			}
+			started++
+		}
+		g.record(command.Period, result, clocks[i], skew)
+	}
+	g.mutex.Lock()
+	g.skews = append(g.skews, latest-earliest)
+	g.mutex.Unlock()
+	if series != nil {
+		series.AddSeconds(MergeTimeSeries(lists), offset)
+	}
+	return results
+}
+
+func MeasureClock(address string) (time.Duration, time.Duration, error) {
+	// offset of the agent clock and round trip, the agent is assumed to read its clock halfway
+	var client = &http.Client{Timeout: 5 * time.Second}
+	var offset, roundTrip time.Duration
+	for i := 0; i < agentClockSamples; i++ {
+		req, err := newAgentRequest("GET", "http://"+address+"/agent/clock", nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		var sent = time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return 0, 0, fmt.Errorf("agent returns %d", resp.StatusCode)
+		}
+		var clock AgentClock
+		err = json.NewDecoder(resp.Body).Decode(&clock)
+		resp.Body.Close()
+		if err != nil {
+			return 0, 0, err
+		}
+		var rtt = time.Since(sent)
+		if i == 0 || rtt < roundTrip {
+			roundTrip = rtt
+			offset = clock.Now.Sub(sent.Add(rtt / 2))
+		}
+	}
+	return offset, roundTrip, nil
+}
+
+func (g *AgentGroup) post(address string, command *AgentPeriodCommand, timeout time.Duration) (*AgentPeriodResult, error) {
+	data, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+	req, err := newAgentRequest("POST", "http://"+address+"/agent/period", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var client = &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returns %d", resp.StatusCode)
+	}
+	var result AgentPeriodResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (g *AgentGroup) record(period int, result *AgentPeriodResult, clock time.Duration, skew time.Duration) {
+	var stats = &AgentPeriodStats{
+		Agent:       result.Agent,
+		Period:      period,
+		Successes:   result.Successes,
+		Error:       result.Error,
+		ClockOffset: clock,
+		StartSkew:   skew,
+	}
+	var latencies = result.Latencies.Histogram()
+	if result.Vegeta != nil {
+		stats.Requests = int(result.Vegeta.Requests)
+	} else if result.Boom != nil {
+		stats.Requests = result.Boom.Requests
+	}
+	stats.Mean = latencies.Mean()
+	stats.P99 = latencies.Quantile(0.99)
+	g.mutex.Lock()
+	g.stats = append(g.stats, stats)
+	g.mutex.Unlock()
+}
+
+func (g *AgentGroup) halt(reason string) {
+	// the first failure aborts the attack on every agent
+	g.mutex.Lock()
+	if g.reason == "" {
+		g.reason = reason
+	}
+	g.mutex.Unlock()
+	g.Stop()
+}
+
+func (g *AgentGroup) Stop() {
+	// best effort, agents not answering finish the period themselves
+	g.mutex.Lock()
+	if g.halted {
+		g.mutex.Unlock()
+		return
+	}
+	g.halted = true
+	g.stopping.Add(len(g.Agents))
+	g.mutex.Unlock()
+	for _, address := range g.Agents {
+		go func(address string) {
+			defer g.stopping.Done()
+			g.notify(address, "/agent/stop")
+		}(address)
+	}
+}
+
+func (g *AgentGroup) Finish() {
+	// agents forget the task once the attack ended, after any stop reached them
+	g.mutex.Lock()
+	g.halted = true
+	g.mutex.Unlock()
+	g.stopping.Wait()
+	var wg sync.WaitGroup
+	for _, address := range g.Agents {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			g.notify(address, "/agent/finish")
+		}(address)
+	}
+	wg.Wait()
+}
+
+func (g *AgentGroup) notify(address string, path string) {
+	// best effort post about the task
+	req, err := newAgentRequest("POST", "http://"+address+path+"?task_id="+g.TaskId, nil)
+	if err != nil {
+		return
+	}
+	var client = &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (g *AgentGroup) Halted() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.halted
+}
+
+func (g *AgentGroup) AbortReason() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.reason
+}
+
+func (g *AgentGroup) Stats() []*AgentPeriodStats {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]*AgentPeriodStats(nil), g.stats...)
+}
+
+func (g *AgentGroup) StartSkews() []time.Duration {
+	// spread between the earliest and latest agent start of each period
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]time.Duration(nil), g.skews...)
+}
+
+func MergeVegetaResults(results []*AgentPeriodResult) (*vegeta.Metrics, *Histogram) {
+	// sum counters of all agents, latencies come from the merged histogram
+	var metrics = &vegeta.Metrics{StatusCodes: make(map[string]int), Errors: []string{}}
+	var histogram = NewHistogram()
+	var successes = 0
+	var errorSeen = make(map[string]bool)
+	for _, result := range results {
+		histogram.Merge(result.Latencies.Histogram())
+		var m = result.Vegeta
+		if m == nil {
+			continue
+		}
+		successes += result.Successes
+		metrics.Requests += m.Requests
+		metrics.BytesIn.Total += m.BytesIn.Total
+		metrics.BytesOut.Total += m.BytesOut.Total
+		for code, count := range m.StatusCodes {
+			metrics.StatusCodes[code] += count
+		}
+		for _, e := range m.Errors {
+			if !errorSeen[e] {
+				errorSeen[e] = true
+				metrics.Errors = append(metrics.Errors, e)
+			}
+		}
+		if m.Requests == 0 {
+			continue
+		}
+		if metrics.Earliest.IsZero() || m.Earliest.Before(metrics.Earliest) {
+			metrics.Earliest = m.Earliest
+		}
+		if m.Latest.After(metrics.Latest) {
+			metrics.Latest = m.Latest
+		}
+		if m.End.After(metrics.End) {
+			metrics.End = m.End
+		}
+	}
+	if metrics.Requests == 0 {
+		return metrics, histogram
+	}
+	metrics.Duration = metrics.Latest.Sub(metrics.Earliest)
+	metrics.Wait = metrics.End.Sub(metrics.Latest)
+	if seconds := metrics.Duration.Seconds(); seconds > 0 {
+		metrics.Rate = float64(metrics.Requests) / seconds
+	}
+	metrics.Success = float64(successes) / float64(metrics.Requests)
+	metrics.BytesIn.Mean = float64(metrics.BytesIn.Total) / float64(metrics.Requests)
+	metrics.BytesOut.Mean = float64(metrics.BytesOut.Total) / float64(metrics.Requests)
+	metrics.Latencies.Total = time.Duration(histogram.Sum) * time.Microsecond
+	metrics.Latencies.Mean = histogram.Mean()
+	metrics.Latencies.P50 = histogram.Quantile(0.5)
+	metrics.Latencies.P95 = histogram.Quantile(0.95)
+	metrics.Latencies.P99 = histogram.Quantile(0.99)
+	metrics.Latencies.Max = time.Duration(histogram.Max) * time.Microsecond
+	return metrics, histogram
+}
+
+func MergeBoomResults(results []*AgentPeriodResult, concurrency int) *Report {
+	// each agent reports like a boom worker of the merged report
+	var workers []*workerStats
+	var duration time.Duration
+	for _, result := range results {
+		if result.Boom == nil {
+			continue
+		}
+		workers = append(workers, &workerStats{
+			requests:       result.Boom.Requests,
+			success:        result.Successes,
+			latencies:      result.Latencies.Histogram(),
+			statusCodeDist: result.Boom.StatusCodeDist,
+			errorDist:      result.Boom.ErrorDist,
+		})
+		if result.Boom.Duration > duration {
+			duration = result.Boom.Duration
+		}
+	}
+	var report = newReport(workers, concurrency, duration)
+	report.finalize()
+	return report
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+func startTestAgents(t *testing.T, h http.Handler, n int) []*httptest.Server {
+	return startSkewedTestAgents(t, h, make([]time.Duration, n))
+}
+
+func registerTestAgent(h http.Handler, token string, address string) int {
+	var body, _ = json.Marshal(&AgentInfo{Name: "agent", Address: address})
+	req, _ := http.NewRequest("POST", "/api/v1/agents", bytes.NewReader(body))
+	req.Header.Set(agentTokenHeader, token)
+	var w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func startSkewedTestAgents(t *testing.T, h http.Handler, skews []time.Duration) []*httptest.Server {
+	// agents with clocks ahead or behind the master
+	G_Agents = NewAgentRegistry()
+	G_AgentToken = "secret"
+	var agents []*httptest.Server
+	for _, skew := range skews {
+		var agent = NewAgent(G_AgentToken)
+		var skew = skew
+		agent.now = func() time.Time {
+			return time.Now().Add(skew)
+		}
+		var server = httptest.NewServer(agent.Handler())
+		if code := registerTestAgent(h, G_AgentToken, strings.TrimPrefix(server.URL, "http://")); code != http.StatusOK {
+			t.Fatalf("agent should be registered, got %d", code)
+		}
+		agents = append(agents, server)
+	}
+	return agents
+}
+
+func Test_SplitShare(t *testing.T) {
+	var shares = SplitShare(11, 3)
+	if len(shares) != 3 || shares[0] != 4 || shares[1] != 4 || shares[2] != 3 {
+		t.Errorf("remainder should go to the first agents, got %v", shares)
+	}
+	if shares = SplitShare(1, 2); shares[0] != 1 || shares[1] != 0 {
+		t.Errorf("small totals leave agents idle, got %v", shares)
+	}
+}
+
+func Test_AgentRegistry(t *testing.T) {
+	var registry = NewAgentRegistry()
+	registry.Register("b", "127.0.0.1:9001")
+	registry.Register("a", "127.0.0.1:9000")
+	registry.agents["127.0.0.1:9002"] = &AgentInfo{Name: "c", Address: "127.0.0.1:9002", SeenAt: time.Now().Add(-agentExpiry - time.Second)}
+	var addresses = registry.LiveAddresses()
+	if len(addresses) != 2 || addresses[0] != "127.0.0.1:9000" {
+		t.Errorf("expired agents should be forgotten, got %v", addresses)
+	}
+}
+
+func Test_MergeVegetaResults(t *testing.T) {
+	var start = time.Now()
+	var results []*AgentPeriodResult
+	for i := 1; i <= 2; i++ {
+		var histogram = NewHistogram()
+		for k := 0; k < 100; k++ {
+			histogram.Record(time.Duration(i*10) * time.Millisecond)
+		}
+		var metrics = &vegeta.Metrics{
+			Requests:    100,
+			Success:     0.9,
+			StatusCodes: map[string]int{"200": 90, "500": 10},
+			Earliest:    start.Add(time.Duration(i) * time.Second),
+			Latest:      start.Add(time.Duration(i+2) * time.Second),
+		}
+		results = append(results, &AgentPeriodResult{Vegeta: metrics, Successes: 90, Latencies: histogram.Snapshot()})
+	}
+	results = append(results, &AgentPeriodResult{Error: "connection refused"})
+	metrics, histogram := MergeVegetaResults(results)
+	if metrics.Requests != 200 || metrics.Success != 0.9 || metrics.StatusCodes["500"] != 20 || metrics.Duration != 3*time.Second {
+		t.Errorf("counters should be summed, got %+v", metrics)
+	}
+	if histogram.Total != 200 || metrics.Latencies.P99 < 19*time.Millisecond || metrics.Latencies.Mean < 14*time.Millisecond {
+		t.Errorf("latencies should come from all agents, got %+v", metrics.Latencies)
+	}
+}
+
+func Test_DistributedBoomJob(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+	var job BoomJobView
+	doJsonRequest(h, "POST", "/api/v1/boom/jobs", map[string]interface{}{"Name": "ping", "Url": "/ping", "Hosts": []string{target.Host()}}, &job)
+	var jobId = job.Id.Hex()
+
+	G_Agents = NewAgentRegistry()
+	var failure struct {
+		Fields FieldErrors `json:"fields"`
+	}
+	var run = map[string]interface{}{"Distributed": true, "Periods": []ConcurrencyPeriod{{2, 1}, {4, 1}}}
+	if code := doJsonRequest(h, "POST", "/api/v1/boom/jobs/"+jobId+"/run", run, &failure); code != http.StatusUnprocessableEntity || len(failure.Fields["Distributed"]) == 0 {
+		t.Errorf("distributed run without agents should be refused, got %d %v", code, failure)
+	}
+
+	for _, agent := range startTestAgents(t, h, 2) {
+		defer agent.Close()
+	}
+	var lg AttackBoomLog
+	if code := doJsonRequest(h, "POST", "/api/v1/boom/jobs/"+jobId+"/run", run, &lg); code != http.StatusAccepted || len(lg.Agents) != 2 {
+		t.Fatalf("distributed run should start on agents, got %d %v", code, lg.Agents)
+	}
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+	doJsonRequest(h, "GET", "/api/v1/boom/logs/"+lg.Id.Hex(), nil, &lg)
+	if lg.State != "End" || len(lg.MetricsList) != 2 || lg.MetricsList[1].Concurrency != 4 || lg.MetricsList[1].Requests == 0 {
+		t.Fatalf("periods should be merged, got %s %v", lg.State, lg.MetricsList)
+	}
+	if len(lg.AgentStats) != 4 || len(lg.Series) == 0 {
+		t.Fatalf("each agent should report each period, got %v", lg.AgentStats)
+	}
+	var requests = 0
+	for _, stats := range lg.AgentStats {
+		if stats.Requests == 0 || stats.Error != "" {
+			t.Errorf("agent should attack, got %+v", stats)
+		}
+		if stats.Period == 1 {
+			requests += stats.Requests
+		}
+	}
+	if requests != lg.MetricsList[1].Requests || int64(requests) > target.Hits() {
+		t.Errorf("merged requests should be the sum of agents, got %d %d", requests, lg.MetricsList[1].Requests)
+	}
+	if w := doRequest(h, "GET", "/boom/metrics", map[string][]string{"log_id": {lg.Id.Hex()}}); !strings.Contains(w.Body.String(), lg.Agents[0]) {
+		t.Errorf("metrics page should show agents")
+	}
+}
+
+func Test_DistributedVegetaJobAgentFailure(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+	var job VegetaJobView
+	doJsonRequest(h, "POST", "/api/v1/vegeta/jobs", map[string]interface{}{"Name": "ping", "Url": "/ping", "Hosts": []string{target.Host()}}, &job)
+	var jobId = job.Id.Hex()
+
+	var agents = startTestAgents(t, h, 2)
+	defer agents[0].Close()
+	agents[1].Close()
+	var lg AttackVegetaLog
+	var run = map[string]interface{}{"Distributed": true, "Periods": []RatePeriod{{20, 1}, {40, 1}}}
+	if code := doJsonRequest(h, "POST", "/api/v1/vegeta/jobs/"+jobId+"/run", run, &lg); code != http.StatusAccepted {
+		t.Fatalf("distributed run should start, got %d", code)
+	}
+	waitJobDone(t, G_RunningVegetaJobs, jobId)
+	doJsonRequest(h, "GET", "/api/v1/vegeta/logs/"+lg.Id.Hex(), nil, &lg)
+	if lg.State != "Aborted" || !strings.Contains(lg.AbortReason, "failed") || len(lg.MetricsList) != 1 {
+		t.Fatalf("failed agent should abort the attack, got %s %q %d", lg.State, lg.AbortReason, len(lg.MetricsList))
+	}
+	var failed = 0
+	for _, stats := range lg.AgentStats {
+		if stats.Error != "" {
+			failed++
+		}
+	}
+	if len(lg.AgentStats) != 2 || failed != 1 {
+		t.Errorf("failed agent should be reported, got %d of %d failed", failed, len(lg.AgentStats))
+	}
+}
+
+func Test_DistributedStartBarrier(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+	var job BoomJobView
+	doJsonRequest(h, "POST", "/api/v1/boom/jobs", map[string]interface{}{"Name": "ping", "Url": "/ping", "Hosts": []string{target.Host()}}, &job)
+	var jobId = job.Id.Hex()
+
+	var skews = []time.Duration{3 * time.Second, -2 * time.Second}
+	var expected = make(map[string]time.Duration)
+	for i, agent := range startSkewedTestAgents(t, h, skews) {
+		defer agent.Close()
+		expected[strings.TrimPrefix(agent.URL, "http://")] = skews[i]
+	}
+	var lg AttackBoomLog
+	var run = map[string]interface{}{"Distributed": true, "Periods": []ConcurrencyPeriod{{2, 1}, {2, 1}}}
+	if code := doJsonRequest(h, "POST", "/api/v1/boom/jobs/"+jobId+"/run", run, &lg); code != http.StatusAccepted {
+		t.Fatalf("distributed run should start, got %d", code)
+	}
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+	doJsonRequest(h, "GET", "/api/v1/boom/logs/"+lg.Id.Hex(), nil, &lg)
+	if lg.State != "End" || len(lg.StartSkews) != 2 || len(lg.AgentStats) != 4 {
+		t.Fatalf("skew of each period should be logged, got %s %v", lg.State, lg.StartSkews)
+	}
+	for _, stats := range lg.AgentStats {
+		if diff := stats.ClockOffset - expected[stats.Agent]; diff < -100*time.Millisecond || diff > 100*time.Millisecond {
+			t.Errorf("clock offset should be measured, got %v for %v", stats.ClockOffset, expected[stats.Agent])
+		}
+		if stats.StartSkew < -100*time.Millisecond || stats.StartSkew > 100*time.Millisecond {
+			t.Errorf("agents should start at the scheduled instant, got %v", stats.StartSkew)
+		}
+	}
+	if lg.MaxStartSkew() > 100*time.Millisecond {
+		t.Errorf("agents should start together, got %v", lg.StartSkews)
+	}
+	if w := doRequest(h, "GET", "/boom/metrics", map[string][]string{"log_id": {lg.Id.Hex()}}); !strings.Contains(w.Body.String(), "Start Skew") {
+		t.Errorf("metrics page should show start skew")
+	}
+}
+
+func Test_AgentToken(t *testing.T) {
+	var h = setupTestServer()
+	G_Agents = NewAgentRegistry()
+	G_AgentToken = ""
+	if code := registerTestAgent(h, "", "127.0.0.1:9000"); code != http.StatusForbidden {
+		t.Errorf("agents should be refused without a master token, got %d", code)
+	}
+	G_AgentToken = "secret"
+	if code := registerTestAgent(h, "guess", "127.0.0.1:9000"); code != http.StatusForbidden || len(G_Agents.Live()) != 0 {
+		t.Errorf("wrong token should be refused, got %d", code)
+	}
+
+	var agent = NewAgent("secret")
+	var server = httptest.NewServer(agent.Handler())
+	defer server.Close()
+	resp, err := http.Post(server.URL+"/agent/period", "application/json", strings.NewReader(`{"Engine": "boom", "BoomJob": {}}`))
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("agent should refuse commands without token, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+	var group = NewAgentGroup("task", []string{strings.TrimPrefix(server.URL, "http://")}, time.Now())
+	group.Stop()
+	group.stopping.Wait()
+	if !agent.stopped.Exists("task") {
+		t.Errorf("master should stop the task with its token")
+	}
+	group.Finish()
+	if !agent.stopped.Empty() {
+		t.Errorf("finished task should be forgotten by the agent")
+	}
+}
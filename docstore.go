@@ -0,0 +1,258 @@
+package main
+
+import (
+	"sort"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type KV interface {
+	// bucketed key value storage holding bson encoded documents
+	Get(bucket string, key string) ([]byte, error)
+	Put(bucket string, key string, value []byte) error
+	// read-modify-write a value atomically
+	Modify(bucket string, key string, fn func(value []byte) ([]byte, error)) error
+	Delete(bucket string, key string) error
+	ForEach(bucket string, fn func(value []byte) error) error
+	Close() error
+}
+
+type DocStore struct {
+	// Store implementation on top of embedded key value storages,
+	// documents are encoded the same way as they are saved in MongoDB
+	kv KV
+}
+
+func NewDocStore(kv KV) *DocStore {
+	return &DocStore{kv}
+}
+
+func (s *DocStore) Close() {
+	s.kv.Close()
+}
+
+func (s *DocStore) get(bucket string, id string, result interface{}) error {
+	value, err := s.kv.Get(bucket, id)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(value, result)
+}
+
+func (s *DocStore) insert(bucket string, id bson.ObjectId, doc interface{}) error {
+	value, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(bucket, id.Hex(), value)
+}
+
+func (s *DocStore) update(bucket string, id string, changed bson.M) error {
+	return s.kv.Modify(bucket, id, func(value []byte) ([]byte, error) {
+		var doc bson.M
+		err := bson.Unmarshal(value, &doc)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range changed {
+			doc[k] = v
+		}
+		return bson.Marshal(doc)
+	})
+}
+
+// Slice bounds of one page, limit 0 means no limit
+func pageBounds(total int, offset int, limit int) (int, int) {
+	if offset > total {
+		offset = total
+	}
+	var end = total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+func (s *DocStore) findVegetaJobs(cond JobCondition) ([]VegetaJob, error) {
+	var jobs []VegetaJob
+	err := s.kv.ForEach("vegeta_jobs", func(value []byte) error {
+		var job VegetaJob
+		err := bson.Unmarshal(value, &job)
+		if err == nil && cond.Match(job.Team, job.Project, job.Url) {
+			jobs = append(jobs, job)
+		}
+		return err
+	})
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].LastRunTs > jobs[j].LastRunTs })
+	return jobs, err
+}
+
+func (s *DocStore) CountVegetaJobs(cond JobCondition) (int, error) {
+	jobs, err := s.findVegetaJobs(cond)
+	return len(jobs), err
+}
+
+func (s *DocStore) FindVegetaJobs(cond JobCondition, offset int, limit int) ([]VegetaJob, error) {
+	jobs, err := s.findVegetaJobs(cond)
+	var start, end = pageBounds(len(jobs), offset, limit)
+	return jobs[start:end], err
+}
+
+func (s *DocStore) GetVegetaJob(jobId string) (*VegetaJob, error) {
+	var job VegetaJob
+	err := s.get("vegeta_jobs", jobId, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *DocStore) InsertVegetaJob(job *VegetaJob) error {
+	return s.insert("vegeta_jobs", job.Id, job)
+}
+
+func (s *DocStore) UpdateVegetaJob(jobId string, changed bson.M) error {
+	return s.update("vegeta_jobs", jobId, changed)
+}
+
+func (s *DocStore) RemoveVegetaJob(jobId string) error {
+	return s.kv.Delete("vegeta_jobs", jobId)
+}
+
+func (s *DocStore) findVegetaLogs(cond LogCondition) ([]AttackVegetaLog, error) {
+	var logs []AttackVegetaLog
+	err := s.kv.ForEach("vegeta_logs", func(value []byte) error {
+		var lg AttackVegetaLog
+		err := bson.Unmarshal(value, &lg)
+		if err == nil && cond.Match(lg.JobId, lg.State) {
+			logs = append(logs, lg)
+		}
+		return err
+	})
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].StartTs > logs[j].StartTs })
+	return logs, err
+}
+
+func (s *DocStore) CountVegetaLogs(cond LogCondition) (int, error) {
+	logs, err := s.findVegetaLogs(cond)
+	return len(logs), err
+}
+
+func (s *DocStore) FindVegetaLogs(cond LogCondition, offset int, limit int) ([]AttackVegetaLog, error) {
+	logs, err := s.findVegetaLogs(cond)
+	var start, end = pageBounds(len(logs), offset, limit)
+	return logs[start:end], err
+}
+
+func (s *DocStore) GetVegetaLog(logId string) (*AttackVegetaLog, error) {
+	var lg AttackVegetaLog
+	err := s.get("vegeta_logs", logId, &lg)
+	if err != nil {
+		return nil, err
+	}
+	return &lg, nil
+}
+
+func (s *DocStore) InsertVegetaLog(lg *AttackVegetaLog) error {
+	return s.insert("vegeta_logs", lg.Id, lg)
+}
+
+func (s *DocStore) UpdateVegetaLog(logId string, changed bson.M) error {
+	return s.update("vegeta_logs", logId, changed)
+}
+
+func (s *DocStore) RemoveVegetaLog(logId string) error {
+	return s.kv.Delete("vegeta_logs", logId)
+}
+
+func (s *DocStore) findBoomJobs(cond JobCondition) ([]BoomJob, error) {
+	var jobs []BoomJob
+	err := s.kv.ForEach("boom_jobs", func(value []byte) error {
+		var job BoomJob
+		err := bson.Unmarshal(value, &job)
+		if err == nil && cond.Match(job.Team, job.Project, job.Url) {
+			jobs = append(jobs, job)
+		}
+		return err
+	})
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].LastRunTs > jobs[j].LastRunTs })
+	return jobs, err
+}
+
+func (s *DocStore) CountBoomJobs(cond JobCondition) (int, error) {
+	jobs, err := s.findBoomJobs(cond)
+	return len(jobs), err
+}
+
+func (s *DocStore) FindBoomJobs(cond JobCondition, offset int, limit int) ([]BoomJob, error) {
+	jobs, err := s.findBoomJobs(cond)
+	var start, end = pageBounds(len(jobs), offset, limit)
+	return jobs[start:end], err
+}
+
+func (s *DocStore) GetBoomJob(jobId string) (*BoomJob, error) {
+	var job BoomJob
+	err := s.get("boom_jobs", jobId, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *DocStore) InsertBoomJob(job *BoomJob) error {
+	return s.insert("boom_jobs", job.Id, job)
+}
+
+func (s *DocStore) UpdateBoomJob(jobId string, changed bson.M) error {
+	return s.update("boom_jobs", jobId, changed)
+}
+
+func (s *DocStore) RemoveBoomJob(jobId string) error {
+	return s.kv.Delete("boom_jobs", jobId)
+}
+
+func (s *DocStore) findBoomLogs(cond LogCondition) ([]AttackBoomLog, error) {
+	var logs []AttackBoomLog
+	err := s.kv.ForEach("boom_logs", func(value []byte) error {
+		var lg AttackBoomLog
+		err := bson.Unmarshal(value, &lg)
+		if err == nil && cond.Match(lg.JobId, lg.State) {
+			logs = append(logs, lg)
+		}
+		return err
+	})
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].StartTs > logs[j].StartTs })
+	return logs, err
+}
+
+func (s *DocStore) CountBoomLogs(cond LogCondition) (int, error) {
+	logs, err := s.findBoomLogs(cond)
+	return len(logs), err
+}
+
+func (s *DocStore) FindBoomLogs(cond LogCondition, offset int, limit int) ([]AttackBoomLog, error) {
+	logs, err := s.findBoomLogs(cond)
+	var start, end = pageBounds(len(logs), offset, limit)
+	return logs[start:end], err
+}
+
+func (s *DocStore) GetBoomLog(logId string) (*AttackBoomLog, error) {
+	var lg AttackBoomLog
+	err := s.get("boom_logs", logId, &lg)
+	if err != nil {
+		return nil, err
+	}
+	return &lg, nil
+}
+
+func (s *DocStore) InsertBoomLog(lg *AttackBoomLog) error {
+	return s.insert("boom_logs", lg.Id, lg)
+}
+
+func (s *DocStore) UpdateBoomLog(logId string, changed bson.M) error {
+	return s.update("boom_logs", logId, changed)
+}
+
+func (s *DocStore) RemoveBoomLog(logId string) error {
+	return s.kv.Delete("boom_logs", logId)
+}
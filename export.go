@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Download reports as csv, json or junit xml for ci systems
+
+type exportFormat struct {
+	Suffix      string // of the downloaded file name
+	ContentType string
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":     {".csv", "text/csv; charset=utf-8"},
+	"seconds": {"-seconds.csv", "text/csv; charset=utf-8"},
+	"json":    {".json", "application/json; charset=utf-8"},
+	"junit":   {".xml", "application/xml; charset=utf-8"},
+}
+
+type ReportExport struct {
+	// engine independent view of an attack log
+	Engine    string
+	LogId     string
+	JobName   string
+	StepName  string
+	State     string
+	StartTs   int64
+	Periods   []*PeriodStats
+	Durations []time.Duration
+	Verdicts  []*Verdict
+	Series    TimeSeries
+	Log       interface{} // the full log for json
+}
+
+func NewVegetaExport(lg *AttackVegetaLog) *ReportExport {
+	var export = &ReportExport{
+		Engine:   "vegeta",
+		LogId:    lg.Id.Hex(),
+		JobName:  lg.JobName,
+		StepName: "QPS",
+		State:    lg.State,
+		StartTs:  lg.StartTs,
+		Periods:  VegetaPeriodStats(lg),
+		Verdicts: lg.Verdicts,
+		Series:   lg.Series,
+		Log:      lg,
+	}
+	for _, metrics := range lg.MetricsList {
+		export.Durations = append(export.Durations, metrics.Duration)
+	}
+	return export
+}
+
+func NewBoomExport(lg *AttackBoomLog) *ReportExport {
+	var export = &ReportExport{
+		Engine:   "boom",
+		LogId:    lg.Id.Hex(),
+		JobName:  lg.JobName,
+		StepName: "Concurrency",
+		State:    lg.State,
+		StartTs:  lg.StartTs,
+		Periods:  BoomPeriodStats(lg),
+		Verdicts: lg.Verdicts,
+		Series:   lg.Series,
+		Log:      lg,
+	}
+	for _, report := range lg.MetricsList {
+		export.Durations = append(export.Durations, report.Duration)
+	}
+	return export
+}
+
+func (e *ReportExport) verdict(i int) *Verdict {
+	// nil without thresholds
+	if i < len(e.Verdicts) {
+		return e.Verdicts[i]
+	}
+	return nil
+}
+
+func (e *ReportExport) Write(w io.Writer, format string) error {
+	switch format {
+	case "csv":
+		return e.WriteCsv(w)
+	case "seconds":
+		return e.WriteSecondsCsv(w)
+	case "json":
+		var encoder = json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(e.Log)
+	case "junit":
+		return e.WriteJUnit(w)
+	}
+	return fmt.Errorf("unknown export format %s", format)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (e *ReportExport) WriteCsv(w io.Writer) error {
+	// one row for each period, latencies in milliseconds
+	var writer = csv.NewWriter(w)
+	writer.Write([]string{"Period", e.StepName, "Duration", "Requests", "Qps", "SuccessRatio", "Mean", "P95", "P99", "Verdict"})
+	for i, stats := range e.Periods {
+		var duration, verdict string
+		if i < len(e.Durations) {
+			duration = formatFloat(e.Durations[i].Seconds())
+		}
+		if v := e.verdict(i); v != nil {
+			verdict = v.String()
+		}
+		writer.Write([]string{
+			strconv.Itoa(i + 1),
+			formatFloat(stats.Step),
+			duration,
+			strconv.Itoa(stats.Requests),
+			formatFloat(stats.Qps),
+			formatFloat(stats.SuccessRatio),
+			formatFloat(stats.Mean),
+			formatFloat(stats.P95),
+			formatFloat(stats.P99),
+			verdict,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (e *ReportExport) WriteSecondsCsv(w io.Writer) error {
+	// one row for each second of the attack, a column for each status code
+	var codes = e.Series.StatusCodesList()
+	var writer = csv.NewWriter(w)
+	var header = []string{"Second", "Period", "Requests", "Successes", "Mean", "P50", "P95", "P99"}
+	for _, code := range codes {
+		header = append(header, "Status"+code)
+	}
+	writer.Write(header)
+	for _, stats := range e.Series {
+		var row = []string{
+			strconv.Itoa(stats.Second),
+			strconv.Itoa(stats.Period + 1),
+			strconv.Itoa(stats.Requests),
+			strconv.Itoa(stats.Successes),
+			formatFloat(stats.Mean.Seconds() * 1000),
+			formatFloat(stats.P50.Seconds() * 1000),
+			formatFloat(stats.P95.Seconds() * 1000),
+			formatFloat(stats.P99.Seconds() * 1000),
+		}
+		for _, code := range codes {
+			row = append(row, strconv.Itoa(stats.StatusCodes[code]))
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+}
+
+type JUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type JUnitTestSuite struct {
+	XMLName    xml.Name         `xml:"testsuite"`
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr"`
+	Properties []*JUnitProperty `xml:"properties>property"`
+	TestCases  []*JUnitTestCase `xml:"testcase"`
+}
+
+func (e *ReportExport) JUnitSuite() *JUnitTestSuite {
+	// each period is a testcase judged by job thresholds
+	var className = fmt.Sprintf("alex.%s.%s", e.Engine, e.JobName)
+	var suite = &JUnitTestSuite{
+		Name:      className,
+		Timestamp: time.Unix(e.StartTs, 0).UTC().Format("2006-01-02T15:04:05"),
+		Properties: []*JUnitProperty{
+			{"log_id", e.LogId},
+			{"state", e.State},
+		},
+	}
+	var total time.Duration
+	for i, stats := range e.Periods {
+		var testCase = &JUnitTestCase{
+			Name:      fmt.Sprintf("period %d %s %s", i+1, e.StepName, formatFloat(stats.Step)),
+			ClassName: className,
+		}
+		if i < len(e.Durations) {
+			testCase.Time = formatFloat(e.Durations[i].Seconds())
+			total += e.Durations[i]
+		}
+		if v := e.verdict(i); v != nil && !v.Passed {
+			testCase.Failure = &JUnitFailure{
+				Message: strings.Join(v.Failures, ", "),
+				Type:    "threshold",
+				Text: fmt.Sprintf("requests %d, qps %.2f, success ratio %.2f%%, mean %.2fms, p95 %.2fms, p99 %.2fms",
+					stats.Requests, stats.Qps, stats.SuccessRatio, stats.Mean, stats.P95, stats.P99),
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Tests = len(suite.TestCases)
+	suite.Time = formatFloat(total.Seconds())
+	return suite
+}
+
+func (e *ReportExport) WriteJUnit(w io.Writer) error {
+	io.WriteString(w, xml.Header)
+	var encoder = xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(e.JUnitSuite()); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func ServeReportExport(w http.ResponseWriter, req *http.Request, export *ReportExport) {
+	// download in the format of the request, csv by default
+	var format = req.FormValue("format")
+	if format == "" {
+		format = "csv"
+	}
+	var kind, ok = exportFormats[format]
+	if !ok {
+		http.Error(w, "format must be csv, seconds, json or junit", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", kind.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="alex-%s-%s%s"`, export.Engine, export.LogId, kind.Suffix))
+	if err := export.Write(w, format); err != nil {
+		log.Println(err)
+	}
+}
+
+func ExportVegetaLog(w http.ResponseWriter, req *http.Request) {
+	lg, err := G_Store.GetVegetaLog(req.FormValue("log_id"))
+	if err != nil {
+		log.Panic(err)
+	}
+	ServeReportExport(w, req, NewVegetaExport(lg))
+}
+
+func ExportBoomLog(w http.ResponseWriter, req *http.Request) {
+	lg, err := G_Store.GetBoomLog(req.FormValue("log_id"))
+	if err != nil {
+		log.Panic(err)
+	}
+	ServeReportExport(w, req, NewBoomExport(lg))
+}
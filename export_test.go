@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func exportedBoomLog() *AttackBoomLog {
+	var reports = []*Report{
+		{Concurrency: 10, Requests: 1000, Qps: 100, SuccessRatio: 100, Duration: 10 * time.Second,
+			Latency: 5 * time.Millisecond, Latency_P95: 8 * time.Millisecond, Latency_P99: 9 * time.Millisecond},
+		{Concurrency: 20, Requests: 1500, Qps: 150, SuccessRatio: 98, Duration: 10 * time.Second,
+			Latency: 50 * time.Millisecond, Latency_P95: 80 * time.Millisecond, Latency_P99: 300 * time.Millisecond},
+	}
+	var thresholds = Thresholds{MaxP99Latency: 200}
+	var series = TimeSeries{
+		{Second: 0, Period: 0, Requests: 100, Successes: 100, P99: 9 * time.Millisecond, StatusCodes: map[string]int{"200": 100}},
+		{Second: 10, Period: 1, Requests: 150, Successes: 147, P99: 300 * time.Millisecond, StatusCodes: map[string]int{"200": 147, "500": 3}},
+	}
+	return &AttackBoomLog{
+		Id:          bson.NewObjectId(),
+		JobId:       "job",
+		JobName:     "ping",
+		State:       "End",
+		StartTs:     1500000000,
+		MetricsList: reports,
+		Series:      series,
+		Verdicts:    []*Verdict{thresholds.CheckBoom(reports[0]), thresholds.CheckBoom(reports[1])},
+	}
+}
+
+func Test_ExportCsv(t *testing.T) {
+	var export = NewBoomExport(exportedBoomLog())
+	var buffer bytes.Buffer
+	if err := export.Write(&buffer, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][1] != "Concurrency" || rows[2][1] != "20" || rows[2][2] != "10" || rows[2][8] != "300" ||
+		rows[1][9] != "PASS" || !strings.HasPrefix(rows[2][9], "FAIL: p99 latency") {
+		t.Errorf("csv should have a row for each period, got %v", rows)
+	}
+
+	buffer.Reset()
+	export.Write(&buffer, "seconds")
+	rows, _ = csv.NewReader(&buffer).ReadAll()
+	if len(rows) != 3 || strings.Join(rows[0], ",") != "Second,Period,Requests,Successes,Mean,P50,P95,P99,Status200,Status500" ||
+		rows[2][1] != "2" || rows[2][9] != "3" || rows[1][9] != "0" {
+		t.Errorf("seconds csv should have a row for each second, got %v", rows)
+	}
+	if export.Write(&buffer, "yaml") == nil {
+		t.Errorf("unknown format should fail")
+	}
+}
+
+func Test_ExportJUnit(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := NewBoomExport(exportedBoomLog()).Write(&buffer, "junit"); err != nil {
+		t.Fatal(err)
+	}
+	var suite JUnitTestSuite
+	if err := xml.Unmarshal(buffer.Bytes(), &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != "alex.boom.ping" || suite.Tests != 2 || suite.Failures != 1 || suite.Time != "20" {
+		t.Errorf("suite should count periods and failures, got %+v", suite)
+	}
+	if suite.TestCases[0].Failure != nil || suite.TestCases[1].Failure == nil ||
+		suite.TestCases[1].Name != "period 2 Concurrency 20" || !strings.HasPrefix(suite.TestCases[1].Failure.Message, "p99 latency") {
+		t.Errorf("failed period should be a failed testcase, got %+v %+v", suite.TestCases[0], suite.TestCases[1])
+	}
+
+	// without thresholds every period passes
+	var lg = exportedBoomLog()
+	lg.Verdicts = nil
+	buffer.Reset()
+	NewBoomExport(lg).Write(&buffer, "junit")
+	if strings.Contains(buffer.String(), "<failure") {
+		t.Errorf("periods without thresholds should pass, got %s", buffer.String())
+	}
+}
+
+func Test_ExportLogDownload(t *testing.T) {
+	var h = setupTestServer()
+	var lg = exportedBoomLog()
+	G_Store.InsertBoomLog(lg)
+
+	var w = doRequest(h, "GET", "/boom/log/export", url.Values{"log_id": {lg.Id.Hex()}, "format": {"json"}})
+	if w.Code != 200 || w.Header().Get("Content-Disposition") != `attachment; filename="alex-boom-`+lg.Id.Hex()+`.json"` {
+		t.Fatalf("json should be downloaded, got %d %v", w.Code, w.Header())
+	}
+	var downloaded AttackBoomLog
+	if err := json.Unmarshal(w.Body.Bytes(), &downloaded); err != nil || len(downloaded.MetricsList) != 2 || len(downloaded.Series) != 2 {
+		t.Errorf("json should contain the full log, got %v %v", downloaded, err)
+	}
+	if w = doRequest(h, "GET", "/boom/log/export", url.Values{"log_id": {lg.Id.Hex()}}); !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("csv should be the default format, got %s", w.Header().Get("Content-Type"))
+	}
+	if w = doRequest(h, "GET", "/boom/log/export", url.Values{"log_id": {lg.Id.Hex()}, "format": {"pdf"}}); w.Code != 400 {
+		t.Errorf("unknown format should be refused, got %d", w.Code)
+	}
+	if w = doRequest(h, "GET", "/boom/metrics", url.Values{"log_id": {lg.Id.Hex()}}); !strings.Contains(w.Body.String(), "/boom/log/export?log_id="+lg.Id.Hex()) {
+		t.Errorf("metrics page should link downloads")
+	}
+}
+
+func Test_ExportStandaloneReport(t *testing.T) {
+	var h = setupTestServer()
+	var lg = exportedBoomLog()
+	G_Store.InsertBoomLog(lg)
+
+	var w = doRequest(h, "GET", "/boom/log/report", url.Values{"log_id": {lg.Id.Hex()}})
+	if w.Code != 200 || w.Header().Get("Content-Disposition") != `attachment; filename="alex-boom-`+lg.Id.Hex()+`.html"` {
+		t.Fatalf("html report should be downloaded, got %d %v", w.Code, w.Header())
+	}
+	var page = w.Body.String()
+	if strings.Contains(page, `src="/static`) || strings.Contains(page, `href="/static`) || strings.Contains(page, "../fonts/") {
+		t.Errorf("assets should be inlined")
+	}
+	for _, part := range []string{"jQuery", "Dygraph", "data:font/woff2;base64,", "graph_percentiles", "Concurrency 20"} {
+		if !strings.Contains(page, part) {
+			t.Errorf("html report should contain %s", part)
+		}
+	}
+	if strings.Contains(page, "/boom/log/export") || strings.Contains(page, "Machine Status") {
+		t.Errorf("html report should not link back to alex")
+	}
+	if w = doRequest(h, "GET", "/boom/metrics", url.Values{"log_id": {lg.Id.Hex()}}); !strings.Contains(w.Body.String(), "/boom/log/report?log_id=") {
+		t.Errorf("metrics page should link html report")
+	}
+}
@@ -2,14 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"log"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
-
-	"gopkg.in/mgo.v2"
+	"time"
 )
 
 // Web UI default Listen address
@@ -19,9 +19,14 @@ var G_AlexPort = 8000
 // Job Storage Default Url
 var G_MongoUrl = "localhost:27017"
 
-// Global MongoDB object
-var G_MongoSession *mgo.Session
-var G_MongoDB *mgo.Database
+// Job Storage Backend ["mongo", "bolt"]
+var G_Storage = "mongo"
+
+// Job Storage File for bolt backend
+var G_BoltPath = "alex.db"
+
+// Global Job Storage object
+var G_Store Store
 
 // vegeta jobs current running
 var G_RunningVegetaJobs = NewConcurrentSet()
@@ -29,12 +34,39 @@ var G_RunningVegetaJobs = NewConcurrentSet()
 // vegeta jobs will stopping
 var G_StoppingVegetaJobs = NewConcurrentSet()
 
+// cancel running vegeta attacks at once
+var G_VegetaCancels = NewCancelMap()
+
+// Returned when starting a job which is already running
+var ErrJobRunning = errors.New("job is running")
+
 // boom jobs current running
 var G_RunningBoomJobs = NewConcurrentSet()
 
 // boom jobs will stopping
 var G_StoppingBoomJobs = NewConcurrentSet()
 
+// cancel running boom attacks at once
+var G_BoomCancels = NewCancelMap()
+
+// live progress subscribers of running jobs
+var G_LiveHub = NewLiveHub()
+
+// prometheus metrics of jobs
+var G_Exporter = NewExporter()
+
+// agents of distributed attacks registered with this master
+var G_Agents = NewAgentRegistry()
+
+// secret shared with agents, distributed mode is off without it
+var G_AgentToken = ""
+
+// push per-second metrics to external time series database, nil for none
+var G_MetricsSink *MetricsSink
+
+// interval of persisting per-second series of running attacks
+var G_LogFlushInterval = 10 * time.Second
+
 // teams for grouping jobs
 var G_AlexTeams = []string{"python"}
 
@@ -43,10 +75,14 @@ var G_ShowLayout = true
 
 // Configuration Object
 type Config struct {
-	BindAddr   string
-	MongoUrl   string
-	Teams      []string
-	ShowLayout bool
+	BindAddr    string
+	MongoUrl    string
+	Storage     string
+	BoltPath    string
+	Teams       []string
+	ShowLayout  bool
+	MetricsSink SinkConfig
+	AgentToken  string
 }
 
 // Load Config from external json file
@@ -72,18 +108,25 @@ func LoadConfig() {
 		}
 		G_AlexTeams = config.Teams
 		G_MongoUrl = config.MongoUrl
+		if config.Storage != "" {
+			G_Storage = config.Storage
+		}
+		if config.BoltPath != "" {
+			G_BoltPath = config.BoltPath
+		}
 		G_ShowLayout = config.ShowLayout
+		G_AgentToken = config.AgentToken
+		if config.MetricsSink.Address != "" {
+			G_MetricsSink, err = NewMetricsSink(config.MetricsSink)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
 	}
 }
 
 func InitGlobals() {
-	session, err := mgo.Dial(G_MongoUrl)
-	if err != nil {
-		log.Panic(err)
-	}
-	session.SetMode(mgo.Monotonic, true)
-	G_MongoSession = session
-	G_MongoDB = session.DB("alex")
+	G_Store = OpenStore(G_Storage)
 	// set golang threads num
 	runtime.GOMAXPROCS(runtime.NumCPU())
 }
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testTarget struct {
+	// stand-in http server receiving benchmark requests
+	*httptest.Server
+	hits int64
+}
+
+func newTestTarget() *testTarget {
+	var target = &testTarget{}
+	target.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&target.hits, 1)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	return target
+}
+
+func (t *testTarget) Host() string {
+	return strings.TrimPrefix(t.URL, "http://")
+}
+
+func (t *testTarget) Hits() int64 {
+	return atomic.LoadInt64(&t.hits)
+}
+
+func setupTestServer() http.Handler {
+	G_Store = NewDocStore(NewMemoryKV())
+	return BuildMartini()
+}
+
+func doRequest(h http.Handler, method string, path string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if method == "POST" {
+		req, _ = http.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, _ = http.NewRequest(method, path+"?"+form.Encode(), nil)
+	}
+	var w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func createdJobId(t *testing.T, w *httptest.ResponseRecorder) string {
+	if w.Code != http.StatusFound {
+		t.Fatalf("create should redirect, got %d", w.Code)
+	}
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("job_id")
+}
+
+func waitJobDone(t *testing.T, running *ConcurrentSet, jobId string) {
+	var deadline = time.Now().Add(20 * time.Second)
+	for running.Exists(jobId) {
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still running", jobId)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func Test_VegetaJobLifecycle(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var w = doRequest(h, "POST", "/vegeta/create", url.Values{"name": {"ping"}, "team": {"go"}, "project": {"alex"}})
+	var jobId = createdJobId(t, w)
+	job, err := G_Store.GetVegetaJob(jobId)
+	if err != nil || job.Name != "ping" || job.Team != "go" {
+		t.Fatalf("job should be created, got %v %v", job, err)
+	}
+	if w = doRequest(h, "GET", "/vegeta/edit", url.Values{"job_id": {jobId}}); w.Code != 200 {
+		t.Errorf("edit page should render, got %d", w.Code)
+	}
+
+	w = doRequest(h, "POST", "/vegeta/edit", url.Values{
+		"job_id":  {jobId},
+		"name":    {"ping"},
+		"team":    {"go"},
+		"project": {"alex"},
+		"method":  {"GET"},
+		"url":     {"/ping"},
+		"host":    {target.Host()},
+		"header":  {`{"X-Alex":"1"}`},
+		"param":   {`{"q":"v"}`},
+		"data":    {`{}`},
+	})
+	if w.Code != http.StatusFound {
+		t.Fatalf("edit should redirect, got %d", w.Code)
+	}
+	job, _ = G_Store.GetVegetaJob(jobId)
+	if job.Url != "/ping" || len(job.Hosts) != 1 || job.Hosts[0] != target.Host() {
+		t.Errorf("job should be updated, got %v", job)
+	}
+	if len(job.Seeds) != 1 || job.Seeds[0].Header["X-Alex"] != "1" || job.Seeds[0].Param["q"] != "v" {
+		t.Errorf("seeds should be parsed from json, got %v", job.Seeds)
+	}
+
+	G_Agents = NewAgentRegistry()
+	w = doRequest(h, "POST", "/vegeta/run", url.Values{
+		"job_id":      {jobId},
+		"workers":     {"2"},
+		"timeout":     {"5"},
+		"rate":        {"20"},
+		"duration":    {"1"},
+		"distributed": {"on"},
+	})
+	if w.Code != 200 || !strings.Contains(w.Body.String(), ErrNoAgents.Error()) || !strings.Contains(w.Body.String(), `name="distributed" checked`) {
+		t.Errorf("distributed run without agents should show field errors, got %d", w.Code)
+	}
+	w = doRequest(h, "POST", "/vegeta/run", url.Values{
+		"job_id":    {jobId},
+		"workers":   {"2"},
+		"timeout":   {"5"},
+		"redirects": {"1"},
+		"keepalive": {"on"},
+		"rate":      {"20", "10"},
+		"duration":  {"1", "1"},
+		"comment":   {"test run"},
+	})
+	if w.Code != http.StatusFound {
+		t.Fatalf("run should redirect, got %d", w.Code)
+	}
+	waitJobDone(t, G_RunningVegetaJobs, jobId)
+
+	logs, err := G_Store.FindVegetaLogs(LogCondition{JobId: jobId}, 0, 0)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("one attack log should be recorded, got %d %v", len(logs), err)
+	}
+	var lg = logs[0]
+	if lg.State != "End" || lg.Comment != "test run" || len(lg.MetricsList) != 2 {
+		t.Fatalf("attack log should be finished with 2 periods, got %v", lg)
+	}
+	if lg.MetricsList[0].Requests == 0 || lg.MetricsList[0].StatusCodes["200"] == 0 {
+		t.Errorf("period metrics should count requests, got %v", lg.MetricsList[0])
+	}
+	if len(lg.Series) < 2 || lg.Series[0].Requests == 0 || lg.Series[len(lg.Series)-1].Period != 1 {
+		t.Errorf("per-second series should cover both periods, got %v", lg.Series)
+	}
+	if len(lg.Percentiles) != 2 || lg.Percentiles[0].Max < lg.Percentiles[0].P50 || lg.Percentiles[0].Min == 0 {
+		t.Errorf("latency percentiles should be recorded for each period, got %v", lg.Percentiles)
+	}
+	if target.Hits() == 0 {
+		t.Error("target should be attacked")
+	}
+	job, _ = G_Store.GetVegetaJob(jobId)
+	if job.CurrentRate != 0 || len(job.Periods) != 2 {
+		t.Errorf("job should keep run settings and reset current rate, got %v", job)
+	}
+
+	var logId = lg.Id.Hex()
+	if w = doRequest(h, "GET", "/vegeta/metrics", url.Values{"log_id": {logId}}); w.Code != 200 || !strings.Contains(w.Body.String(), "QPS 10") {
+		t.Errorf("metrics page should render, got %d", w.Code)
+	}
+	if w = doRequest(h, "GET", "/vegeta/logs", url.Values{"job_id": {jobId}}); w.Code != 200 {
+		t.Errorf("logs page should render, got %d", w.Code)
+	}
+	if w = doRequest(h, "GET", "/vegeta/", url.Values{"team": {"go"}}); w.Code != 200 || !strings.Contains(w.Body.String(), jobId) {
+		t.Errorf("job list should contain the job, got %d", w.Code)
+	}
+	doRequest(h, "GET", "/vegeta/log/delete", url.Values{"log_id": {logId}})
+	if _, err = G_Store.GetVegetaLog(logId); err != ErrNotFound {
+		t.Errorf("log should be deleted, got %v", err)
+	}
+	doRequest(h, "GET", "/vegeta/delete", url.Values{"job_id": {jobId}})
+	if _, err = G_Store.GetVegetaJob(jobId); err != ErrNotFound {
+		t.Errorf("job should be deleted, got %v", err)
+	}
+}
+
+func Test_BoomJobLifecycle(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var w = doRequest(h, "POST", "/boom/create", url.Values{"name": {"ping"}, "team": {"go"}, "project": {"alex"}})
+	var jobId = createdJobId(t, w)
+	if w = doRequest(h, "GET", "/boom/edit", url.Values{"job_id": {jobId}}); w.Code != 200 {
+		t.Errorf("edit page should render, got %d", w.Code)
+	}
+
+	w = doRequest(h, "POST", "/boom/edit", url.Values{
+		"job_id":      {jobId},
+		"name":        {"ping"},
+		"method":      {"GET"},
+		"url":         {"ping"},
+		"header":      {`{}`},
+		"param":       {`{}`},
+		"data":        {`{}`},
+		"body_regexp": {"("},
+	})
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "url must start with /") || !strings.Contains(w.Body.String(), "invalid body regexp") {
+		t.Errorf("invalid edit should show field errors, got %d", w.Code)
+	}
+	if job, _ := G_Store.GetBoomJob(jobId); job.Url == "ping" || job.Assertions.BodyRegexp != "" {
+		t.Errorf("invalid edit should not be saved, got %v", job)
+	}
+
+	w = doRequest(h, "POST", "/boom/edit", url.Values{
+		"job_id":    {jobId},
+		"name":      {"ping"},
+		"team":      {"go"},
+		"project":   {"alex"},
+		"method":    {"POST"},
+		"url":       {"/ping"},
+		"host":      {target.Host()},
+		"jsonified": {"on"},
+		"header":    {`{}`},
+		"param":     {`{}`},
+		"data":      {`{"k":1}`},
+	})
+	if w.Code != http.StatusFound {
+		t.Fatalf("edit should redirect, got %d", w.Code)
+	}
+	job, _ := G_Store.GetBoomJob(jobId)
+	if job.Method != "POST" || !job.Jsonified || len(job.Seeds) != 1 || job.Seeds[0].JsonData != `{"k":1}` {
+		t.Errorf("job should be updated, got %v", job)
+	}
+
+	w = doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"0"},
+		"concurrency": {"2"},
+		"duration":    {"1"},
+	})
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "timeout must be positive") {
+		t.Errorf("invalid run should show field errors, got %d", w.Code)
+	}
+	if count, _ := G_Store.CountBoomLogs(LogCondition{JobId: jobId}); count != 0 || G_RunningBoomJobs.Exists(jobId) {
+		t.Errorf("invalid run should not start, got %d logs", count)
+	}
+	w = doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2"},
+		"duration":    {"1"},
+		"comment":     {"test run"},
+	})
+	if w.Code != http.StatusFound {
+		t.Fatalf("run should redirect, got %d", w.Code)
+	}
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+
+	logs, err := G_Store.FindBoomLogs(LogCondition{JobId: jobId}, 0, 0)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("one attack log should be recorded, got %d %v", len(logs), err)
+	}
+	var lg = logs[0]
+	if lg.State != "End" || len(lg.MetricsList) != 1 {
+		t.Fatalf("attack log should be finished with 1 period, got %v", lg)
+	}
+	var report = lg.MetricsList[0]
+	if report.Concurrency != 2 || report.Requests == 0 || report.SuccessRatio != 100 || report.StatusCodeDist["200"] == 0 {
+		t.Errorf("report should count successful requests, got %v", report)
+	}
+	if target.Hits() < int64(report.Requests) {
+		t.Errorf("target should receive %d requests, got %d", report.Requests, target.Hits())
+	}
+	if len(lg.Series) == 0 || lg.Series[0].StatusCodes["200"] == 0 {
+		t.Errorf("per-second series should be recorded, got %v", lg.Series)
+	}
+	if report.Percentiles == nil || report.Percentiles.P9999 < report.Percentiles.P99 || report.Percentiles.Max < report.Percentiles.P9999 {
+		t.Errorf("report should record latency percentiles, got %v", report.Percentiles)
+	}
+	if w = doRequest(h, "GET", "/boom/metrics", url.Values{"log_id": {lg.Id.Hex()}}); w.Code != 200 || !strings.Contains(w.Body.String(), "graph_percentiles") {
+		t.Errorf("metrics page should render, got %d", w.Code)
+	}
+	if w = doRequest(h, "GET", "/api/boom/state", url.Values{"job_id": {jobId}}); !strings.Contains(w.Body.String(), `"is_running":false`) {
+		t.Errorf("job state should not be running, got %s", w.Body.String())
+	}
+}
+
+func Test_StopVegetaJob(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/vegeta/create", url.Values{"name": {"stop"}}))
+	G_Store.UpdateVegetaJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	doRequest(h, "POST", "/vegeta/run", url.Values{
+		"job_id":   {jobId},
+		"workers":  {"2"},
+		"timeout":  {"5"},
+		"rate":     {"10", "10", "10"},
+		"duration": {"1", "1", "1"},
+	})
+	if w := doRequest(h, "GET", "/api/vegeta/state", url.Values{"job_id": {jobId}}); !strings.Contains(w.Body.String(), `"is_running":true`) {
+		t.Errorf("job state should be running, got %s", w.Body.String())
+	}
+	doRequest(h, "GET", "/vegeta/stop", url.Values{"job_id": {jobId}})
+	waitJobDone(t, G_RunningVegetaJobs, jobId)
+	logs, _ := G_Store.FindVegetaLogs(LogCondition{JobId: jobId}, 0, 0)
+	if len(logs) != 1 || len(logs[0].MetricsList) >= 3 {
+		t.Errorf("stopped job should skip remaining periods, got %v", logs)
+	}
+}
+
+func Test_StopVegetaJobMidPeriod(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/vegeta/create", url.Values{"name": {"stop now"}}))
+	G_Store.UpdateVegetaJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	doRequest(h, "POST", "/vegeta/run", url.Values{
+		"job_id":   {jobId},
+		"workers":  {"2"},
+		"timeout":  {"5"},
+		"rate":     {"10", "10"},
+		"duration": {"10", "10"},
+	})
+	time.Sleep(500 * time.Millisecond)
+	var start = time.Now()
+	doRequest(h, "GET", "/vegeta/stop", url.Values{"job_id": {jobId}})
+	waitJobDone(t, G_RunningVegetaJobs, jobId)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("stop should cut current period, took %v", elapsed)
+	}
+	logs, _ := G_Store.FindVegetaLogs(LogCondition{JobId: jobId}, 0, 0)
+	if len(logs) != 1 || logs[0].State != "Stopped" || len(logs[0].MetricsList) != 1 || logs[0].MetricsList[0].Requests == 0 {
+		t.Errorf("stopped log should keep partial period, got %v", logs)
+	}
+}
+
+func Test_StopBoomJobMidPeriod(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/boom/create", url.Values{"name": {"stop now"}}))
+	G_Store.UpdateBoomJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2", "2"},
+		"duration":    {"10", "10"},
+	})
+	time.Sleep(500 * time.Millisecond)
+	var start = time.Now()
+	doRequest(h, "GET", "/boom/stop", url.Values{"job_id": {jobId}})
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("stop should cut current period, took %v", elapsed)
+	}
+	logs, _ := G_Store.FindBoomLogs(LogCondition{JobId: jobId}, 0, 0)
+	if len(logs) != 1 || logs[0].State != "Stopped" || len(logs[0].MetricsList) != 1 || logs[0].MetricsList[0].Requests == 0 {
+		t.Errorf("stopped log should keep partial period, got %v", logs)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Headless one-shot mode running a job definition file without web UI and database
+
+func init() {
+	G_Commands["run"] = HeadlessCommand
+}
+
+// Guess engine from period settings of the job definition
+func DetectJobEngine(data []byte) (string, error) {
+	var definition struct {
+		Periods []map[string]interface{}
+		Search  map[string]interface{}
+	}
+	err := json.Unmarshal(data, &definition)
+	if err != nil {
+		return "", err
+	}
+	if definition.Search != nil {
+		return "vegeta", nil
+	}
+	for _, period := range definition.Periods {
+		if _, ok := period["Concurrency"]; ok {
+			return "boom", nil
+		}
+		if _, ok := period["Rate"]; ok {
+			return "vegeta", nil
+		}
+	}
+	return "", fmt.Errorf("can not detect engine from periods, use -engine")
+}
+
+func HeadlessCommand(args []string) int {
+	var fs = flag.NewFlagSet("run", flag.ContinueOnError)
+	var file = fs.String("f", "", "job definition file, serialized VegetaJob or BoomJob")
+	var engine = fs.String("engine", "", "vegeta or boom, detected from periods by default")
+	var comment = fs.String("comment", "headless run", "comment of the attack log")
+	var format = fs.String("format", "text", "report format, text or json")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitError
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "usage: alex run -f job.json [-engine vegeta|boom] [-format text|json]")
+		return ExitError
+	}
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	if *engine == "" {
+		*engine, err = DetectJobEngine(data)
+	} else {
+		err = checkEngine(*engine)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	var name = strings.TrimSuffix(filepath.Base(*file), filepath.Ext(*file))
+	G_Store = NewDocStore(NewMemoryKV())
+	if *engine == "vegeta" {
+		return runVegetaHeadless(data, name, *comment, *format, os.Stdout)
+	}
+	return runBoomHeadless(data, name, *comment, *format, os.Stdout)
+}
+
+// Stop job at once on interrupt
+func stopOnInterrupt(stop func(jobId string), jobId string) func() {
+	var signals = make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			fmt.Fprintln(os.Stderr, "interrupted, stopping job")
+			stop(jobId)
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+func verdictExitCode(verdict *Verdict) int {
+	// thresholds decide the exit code when configured
+	if verdict.Passed {
+		return ExitOk
+	}
+	return ExitFailure
+}
+
+func printJson(out io.Writer, v interface{}) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Fprintln(out, string(data))
+}
+
+func runVegetaHeadless(data []byte, name string, comment string, format string, out io.Writer) int {
+	var job = NewVegetaJob(name, "", "")
+	err := json.Unmarshal(data, job)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	job.Id = bson.NewObjectId()
+	if errs := job.ValidateRun(); len(errs) > 0 {
+		for field, reasons := range errs {
+			for _, reason := range reasons {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", field, reason)
+			}
+		}
+		return ExitError
+	}
+	G_Store.InsertVegetaJob(job)
+	G_RunningVegetaJobs.Put(job.Id.Hex())
+	var release = stopOnInterrupt(StopVegetaAttack, job.Id.Hex())
+	AttackVegetaJob(job, LogAttackVegetaStart(job, comment))
+	release()
+	logs, err := G_Store.FindVegetaLogs(LogCondition{JobId: job.Id.Hex()}, 0, 1)
+	if err != nil || len(logs) == 0 {
+		fmt.Fprintln(os.Stderr, "attack log is missing", err)
+		return ExitError
+	}
+	var lg = &logs[0]
+	if format == "json" {
+		printJson(out, lg)
+	} else {
+		PrintVegetaReport(out, lg)
+	}
+	if lg.State != "End" {
+		return ExitFailure
+	}
+	if lg.Verdict != nil {
+		return verdictExitCode(lg.Verdict)
+	}
+	for _, metrics := range lg.MetricsList {
+		if metrics.Success < 1 {
+			return ExitFailure
+		}
+	}
+	return ExitOk
+}
+
+func runBoomHeadless(data []byte, name string, comment string, format string, out io.Writer) int {
+	var job = NewBoomJob(name, "", "")
+	err := json.Unmarshal(data, job)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	job.Id = bson.NewObjectId()
+	if errs := job.ValidateRun(); len(errs) > 0 {
+		for field, reasons := range errs {
+			for _, reason := range reasons {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", field, reason)
+			}
+		}
+		return ExitError
+	}
+	G_Store.InsertBoomJob(job)
+	G_RunningBoomJobs.Put(job.Id.Hex())
+	var release = stopOnInterrupt(StopBoomAttack, job.Id.Hex())
+	AttackBoomJob(job, LogAttackBoomStart(job, comment))
+	release()
+	logs, err := G_Store.FindBoomLogs(LogCondition{JobId: job.Id.Hex()}, 0, 1)
+	if err != nil || len(logs) == 0 {
+		fmt.Fprintln(os.Stderr, "attack log is missing", err)
+		return ExitError
+	}
+	var lg = &logs[0]
+	if format == "json" {
+		printJson(out, lg)
+	} else {
+		PrintBoomReport(out, lg)
+	}
+	if lg.State != "End" {
+		return ExitFailure
+	}
+	if lg.Verdict != nil {
+		return verdictExitCode(lg.Verdict)
+	}
+	for _, report := range lg.MetricsList {
+		if report.SuccessRatio < 100 {
+			return ExitFailure
+		}
+	}
+	return ExitOk
+}
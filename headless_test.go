@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_DetectJobEngine(t *testing.T) {
+	var cases = map[string]string{
+		`{"Periods": [{"Rate": 10, "Duration": 1}]}`:        "vegeta",
+		`{"Periods": [{"Concurrency": 10, "Duration": 1}]}`: "boom",
+		`{"Periods": []}`: "",
+	}
+	for data, expected := range cases {
+		engine, _ := DetectJobEngine([]byte(data))
+		if engine != expected {
+			t.Errorf("engine of %s should be %q, got %q", data, expected, engine)
+		}
+	}
+}
+
+func Test_HeadlessRun(t *testing.T) {
+	var target = newTestTarget()
+	defer target.Close()
+	dir, _ := ioutil.TempDir("", "alex")
+	defer os.RemoveAll(dir)
+
+	var file = filepath.Join(dir, "ping.json")
+	ioutil.WriteFile(file, []byte(fmt.Sprintf(`{
+		"Url": "/ping",
+		"Hosts": [%q],
+		"Workers": 2,
+		"Periods": [{"Rate": 10, "Duration": 1}]
+	}`, target.Host())), 0644)
+	if code := HeadlessCommand([]string{"-f", file}); code != ExitOk {
+		t.Errorf("headless vegeta run should succeed, got %d", code)
+	}
+	if target.Hits() == 0 {
+		t.Errorf("target should be attacked")
+	}
+
+	var out bytes.Buffer
+	var data = []byte(fmt.Sprintf(`{"Url": "/ping", "Hosts": [%q], "Periods": [{"Concurrency": 2, "Duration": 1}]}`, target.Host()))
+	if code := runBoomHeadless(data, "ping", "test", "text", &out); code != ExitOk || out.Len() == 0 {
+		t.Errorf("headless boom run should succeed, got %d %s", code, out.String())
+	}
+
+	ioutil.WriteFile(file, []byte(`{"Url": "/ping", "Periods": [{"Rate": 10, "Duration": 1}], "Hosts": []}`), 0644)
+	if code := HeadlessCommand([]string{"-f", file}); code != ExitError {
+		t.Errorf("invalid definition should be rejected, got %d", code)
+	}
+}
@@ -80,6 +80,14 @@ func GenMethodSelectors(method string) []MethodSelector {
 	return methods
 }
 
+func IsValidMethod(method string) bool {
+	switch method {
+	case "", "GET", "POST", "PUT", "DELETE", "HEAD":
+		return true
+	}
+	return false
+}
+
 func GenTeamSelectors(team string) []TeamSelector {
 	var teams = make([]TeamSelector, len(G_AlexTeams)+1)
 	teams[0] = TeamSelector{"", false}
@@ -135,6 +143,17 @@ func (this *ConcurrentSet) Put(key string) {
 	this.d[key] = true
 }
 
+func (this *ConcurrentSet) PutIfAbsent(key string) bool {
+	// put key unless it already exists, returns whether it was put
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.d[key] {
+		return false
+	}
+	this.d[key] = true
+	return true
+}
+
 func (this *ConcurrentSet) Exists(key string) bool {
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
@@ -147,3 +166,67 @@ func (this *ConcurrentSet) Delete(key string) {
 	defer this.mutex.Unlock()
 	delete(this.d, key)
 }
+
+type CancelMap struct {
+	// thread safe cancel functions keyed by job id
+	d     map[string]func()
+	mutex sync.Mutex
+}
+
+func NewCancelMap() *CancelMap {
+	return &CancelMap{map[string]func(){}, sync.Mutex{}}
+}
+
+func (this *CancelMap) Put(key string, cancel func()) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.d[key] = cancel
+}
+
+func (this *CancelMap) Delete(key string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.d, key)
+}
+
+func (this *CancelMap) Cancel(key string) bool {
+	// call and forget cancel function, returns whether it existed
+	this.mutex.Lock()
+	var cancel, ok = this.d[key]
+	delete(this.d, key)
+	this.mutex.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+type LogFlusher struct {
+	// calls flush every interval until stopped
+	done    chan bool
+	stopped chan bool
+}
+
+func StartLogFlusher(interval time.Duration, flush func()) *LogFlusher {
+	var f = &LogFlusher{done: make(chan bool), stopped: make(chan bool)}
+	go func() {
+		defer close(f.stopped)
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-f.done:
+				return
+			}
+		}
+	}()
+	return f
+}
+
+func (f *LogFlusher) Stop() {
+	// waits for a running flush, nothing is written afterwards
+	close(f.done)
+	<-f.stopped
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Mergeable latency histogram with constant memory
+
+const histogramSubBits = 8
+const histogramSubCount = 1 << histogramSubBits
+const histogramHalfCount = histogramSubCount / 2
+const histogramMaxBits = 32 // about 71 minutes in microseconds, larger values are clamped
+const histogramBuckets = histogramSubCount + (histogramMaxBits-histogramSubBits)*histogramHalfCount
+
+type Histogram struct {
+	// log-linear buckets of microsecond values, relative error below 1/histogramHalfCount
+	Counts []int64
+	Total  int64
+	Sum    int64 // microseconds
+	Min    int64
+	Max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{Counts: make([]int64, histogramBuckets)}
+}
+
+func histogramIndex(v int64) int {
+	// values below histogramSubCount are exact, then histogramHalfCount buckets for each doubling
+	if v < histogramSubCount {
+		return int(v)
+	}
+	var bits = 0
+	for x := v; x > 0; x >>= 1 {
+		bits++
+	}
+	if bits > histogramMaxBits {
+		return histogramBuckets - 1
+	}
+	var shift = uint(bits - histogramSubBits)
+	return histogramSubCount + int(shift-1)*histogramHalfCount + int(v>>shift) - histogramHalfCount
+}
+
+func histogramHighest(index int) int64 {
+	// highest value falling into the bucket
+	if index < histogramSubCount {
+		return int64(index)
+	}
+	var shift = uint((index-histogramSubCount)/histogramHalfCount + 1)
+	var sub = int64((index-histogramSubCount)%histogramHalfCount + histogramHalfCount)
+	return (sub+1)<<shift - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	var v = int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	h.Counts[histogramIndex(v)]++
+	if h.Total == 0 || v < h.Min {
+		h.Min = v
+	}
+	if v > h.Max {
+		h.Max = v
+	}
+	h.Total++
+	h.Sum += v
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	if other.Total == 0 {
+		return
+	}
+	for i, count := range other.Counts {
+		h.Counts[i] += count
+	}
+	if h.Total == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+	h.Total += other.Total
+	h.Sum += other.Sum
+}
+
+func (h *Histogram) Reset() {
+	for i := range h.Counts {
+		h.Counts[i] = 0
+	}
+	h.Total, h.Sum, h.Min, h.Max = 0, 0, 0, 0
+}
+
+func (h *Histogram) Quantile(q float64) time.Duration {
+	// value at quantile q between 0 and 1, zero for empty histogram
+	if h.Total == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return time.Duration(h.Min) * time.Microsecond
+	}
+	var rank = int64(math.Ceil(q * float64(h.Total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range h.Counts {
+		seen += count
+		if seen >= rank {
+			var v = histogramHighest(i)
+			if v > h.Max || i == histogramBuckets-1 {
+				v = h.Max
+			}
+			if v < h.Min {
+				v = h.Min
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return time.Duration(h.Max) * time.Microsecond
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.Total == 0 {
+		return 0
+	}
+	return time.Duration(h.Sum/h.Total) * time.Microsecond
+}
+
+type LatencyPercentiles struct {
+	// latency distribution of one period, microsecond precision
+	Min   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	P999  time.Duration
+	P9999 time.Duration
+	Max   time.Duration
+}
+
+func (h *Histogram) Percentiles() *LatencyPercentiles {
+	return &LatencyPercentiles{
+		Min:   h.Quantile(0),
+		P50:   h.Quantile(0.5),
+		P90:   h.Quantile(0.9),
+		P95:   h.Quantile(0.95),
+		P99:   h.Quantile(0.99),
+		P999:  h.Quantile(0.999),
+		P9999: h.Quantile(0.9999),
+		Max:   h.Quantile(1),
+	}
+}
+
+func (p *LatencyPercentiles) Values() []time.Duration {
+	// in the order of chart x axis
+	return []time.Duration{p.Min, p.P50, p.P90, p.P95, p.P99, p.P999, p.P9999, p.Max}
+}
+
+type PercentileRow struct {
+	// percentiles of one period, nil for logs recorded before percentiles
+	Name        string
+	Percentiles *LatencyPercentiles
+}
+
+type PercentileTable []*PercentileRow
+
+func (t PercentileTable) ChartLabels() string {
+	// dygraph csv header, one series for each period
+	var buffer bytes.Buffer
+	buffer.WriteString("Percentile")
+	for _, row := range t {
+		buffer.WriteString("," + row.Name)
+	}
+	return buffer.String()
+}
+
+func (t PercentileTable) ChartData() string {
+	// x is the index of percentile, labelled by the page
+	var buffer bytes.Buffer
+	for i := 0; i < len((&LatencyPercentiles{}).Values()); i++ {
+		buffer.WriteString(strconv.Itoa(i))
+		for _, row := range t {
+			buffer.WriteString(",")
+			if row.Percentiles != nil {
+				buffer.WriteString(fmt.Sprintf("%v", row.Percentiles.Values()[i].Seconds()*1000))
+			}
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.String()
+}
+
+type HistogramSnapshot struct {
+	// non-empty buckets of a histogram, compact for sending between processes
+	Index  []int
+	Counts []int64
+	Total  int64
+	Sum    int64
+	Min    int64
+	Max    int64
+}
+
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+	var s = &HistogramSnapshot{Total: h.Total, Sum: h.Sum, Min: h.Min, Max: h.Max}
+	for i, count := range h.Counts {
+		if count > 0 {
+			s.Index = append(s.Index, i)
+			s.Counts = append(s.Counts, count)
+		}
+	}
+	return s
+}
+
+func (s *HistogramSnapshot) Histogram() *Histogram {
+	var h = NewHistogram()
+	if s == nil {
+		return h
+	}
+	for i, index := range s.Index {
+		if index >= 0 && index < histogramBuckets && i < len(s.Counts) {
+			h.Counts[index] = s.Counts[i]
+		}
+	}
+	h.Total, h.Sum, h.Min, h.Max = s.Total, s.Sum, s.Min, s.Max
+	return h
+}
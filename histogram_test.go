@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_HistogramQuantile(t *testing.T) {
+	var h = NewHistogram()
+	if h.Quantile(0.99) != 0 || h.Mean() != 0 {
+		t.Errorf("empty histogram should report zero")
+	}
+	var values []time.Duration
+	for i := 0; i < 10000; i++ {
+		var d = time.Duration(rand.Int63n(int64(2*time.Second))) + time.Microsecond
+		values = append(values, d)
+		h.Record(d)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		var exact = values[int(q*float64(len(values)))-1]
+		var got = h.Quantile(q)
+		if got < exact*99/100 || got > exact*101/100 {
+			t.Errorf("quantile %v should be within 1%% of %v, got %v", q, exact, got)
+		}
+	}
+	if h.Quantile(1) != values[len(values)-1]/time.Microsecond*time.Microsecond {
+		t.Errorf("max quantile should be the max value, got %v", h.Quantile(1))
+	}
+	if h.Quantile(0) != values[0]/time.Microsecond*time.Microsecond {
+		t.Errorf("min quantile should be the min value, got %v", h.Quantile(0))
+	}
+}
+
+func Test_HistogramMerge(t *testing.T) {
+	var a, b = NewHistogram(), NewHistogram()
+	for i := 1; i <= 100; i++ {
+		a.Record(time.Duration(i) * time.Microsecond)
+		b.Record(time.Duration(i+100) * time.Microsecond)
+	}
+	a.Merge(b)
+	a.Merge(NewHistogram())
+	if a.Total != 200 || a.Min != 1 || a.Max != 200 || a.Quantile(0.5) != 100*time.Microsecond {
+		t.Errorf("merged histogram should cover both, got %d %d %d %v", a.Total, a.Min, a.Max, a.Quantile(0.5))
+	}
+	if a.Mean() != 100*time.Microsecond {
+		t.Errorf("mean should be 100us, got %v", a.Mean())
+	}
+	a.Record(1000 * 24 * time.Hour)
+	if a.Max != int64(1000*24*time.Hour/time.Microsecond) || a.Quantile(1) != 1000*24*time.Hour {
+		t.Errorf("huge values should be clamped into the last bucket, got %v", a.Quantile(1))
+	}
+}
+
+func Test_PercentileTable(t *testing.T) {
+	var h = NewHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	var p = h.Percentiles()
+	if p.Min != time.Millisecond || p.Max != time.Second || p.P50 < 496*time.Millisecond || p.P50 > 504*time.Millisecond {
+		t.Errorf("percentiles should follow recorded values, got %v", p)
+	}
+	var table = PercentileTable{{"QPS 10", p}, {"QPS 20", nil}}
+	if table.ChartLabels() != "Percentile,QPS 10,QPS 20" {
+		t.Errorf("chart labels should name periods, got %s", table.ChartLabels())
+	}
+	var lines = strings.Split(strings.TrimSpace(table.ChartData()), "\n")
+	if len(lines) != 8 || lines[0] != "0,1," || lines[7] != "7,1000," {
+		t.Errorf("chart data should have a row for each percentile, got %v", lines)
+	}
+}
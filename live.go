@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/martini-contrib/render"
+)
+
+// Live progress of running jobs pushed as server-sent events
+
+type LiveEvent struct {
+	// one second of a running attack, or the final state when State is not Running
+	State     string
+	LogId     string
+	Second    int
+	Period    int
+	Requests  int
+	Successes int
+	Errors    int
+	Mean      float64 // milliseconds
+	P50       float64
+	P95       float64
+	P99       float64
+}
+
+func NewLiveSecondEvent(logId string, stats *SecondStats) *LiveEvent {
+	return &LiveEvent{
+		State:     "Running",
+		LogId:     logId,
+		Second:    stats.Second,
+		Period:    stats.Period,
+		Requests:  stats.Requests,
+		Successes: stats.Successes,
+		Errors:    stats.Requests - stats.Successes,
+		Mean:      stats.Mean.Seconds() * 1000,
+		P50:       stats.P50.Seconds() * 1000,
+		P95:       stats.P95.Seconds() * 1000,
+		P99:       stats.P99.Seconds() * 1000,
+	}
+}
+
+type LiveHub struct {
+	// subscribers of each job, slow subscribers miss events instead of blocking attack
+	subscribers map[string]map[chan *LiveEvent]bool
+	mutex       sync.Mutex
+}
+
+func NewLiveHub() *LiveHub {
+	return &LiveHub{subscribers: make(map[string]map[chan *LiveEvent]bool)}
+}
+
+func (this *LiveHub) Subscribe(jobId string) chan *LiveEvent {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	var ch = make(chan *LiveEvent, 16)
+	if this.subscribers[jobId] == nil {
+		this.subscribers[jobId] = make(map[chan *LiveEvent]bool)
+	}
+	this.subscribers[jobId][ch] = true
+	return ch
+}
+
+func (this *LiveHub) Unsubscribe(jobId string, ch chan *LiveEvent) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.subscribers[jobId], ch)
+	if len(this.subscribers[jobId]) == 0 {
+		delete(this.subscribers, jobId)
+	}
+}
+
+func (this *LiveHub) Publish(jobId string, event *LiveEvent) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for ch := range this.subscribers[jobId] {
+		select {
+		case ch <- event:
+		default:
+			if event.State != "Running" {
+				// make room for the end event, the stream is closed after it
+				select {
+				case <-ch:
+				default:
+				}
+				select {
+				case ch <- event:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func StreamLiveEvents(w http.ResponseWriter, req *http.Request, jobId string, running *ConcurrentSet) {
+	// stream events of the job until it ends or the client goes away
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	var ch = G_LiveHub.Subscribe(jobId)
+	defer G_LiveHub.Unsubscribe(jobId, ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	// subscribed before checking so the end event cannot be missed
+	if !running.Exists(jobId) {
+		writeLiveEvent(w, &LiveEvent{State: "Quiet"})
+		flusher.Flush()
+		return
+	}
+	flusher.Flush()
+	for {
+		select {
+		case event := <-ch:
+			writeLiveEvent(w, event)
+			flusher.Flush()
+			if event.State != "Running" {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func writeLiveEvent(w http.ResponseWriter, event *LiveEvent) {
+	var name = "second"
+	if event.State != "Running" {
+		name = "end"
+	}
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+func StreamVegetaLive(w http.ResponseWriter, req *http.Request) {
+	var jobId = req.FormValue("job_id")
+	StreamLiveEvents(w, req, jobId, G_RunningVegetaJobs)
+}
+
+func StreamBoomLive(w http.ResponseWriter, req *http.Request) {
+	var jobId = req.FormValue("job_id")
+	StreamLiveEvents(w, req, jobId, G_RunningBoomJobs)
+}
+
+func GetVegetaLive(req *http.Request, r render.Render) {
+	job, err := G_Store.GetVegetaJob(req.FormValue("job_id"))
+	if err != nil {
+		log.Panic(err)
+	}
+	var context = make(map[string]interface{})
+	context["engine"] = "vegeta"
+	context["jobId"] = job.Id.Hex()
+	context["jobName"] = job.Name
+	context["running"] = job.IsRunning()
+	RenderTemplate(r, "live", context)
+}
+
+func GetBoomLive(req *http.Request, r render.Render) {
+	job, err := G_Store.GetBoomJob(req.FormValue("job_id"))
+	if err != nil {
+		log.Panic(err)
+	}
+	var context = make(map[string]interface{})
+	context["engine"] = "boom"
+	context["jobId"] = job.Id.Hex()
+	context["jobName"] = job.Name
+	context["running"] = job.IsRunning()
+	RenderTemplate(r, "live", context)
+}
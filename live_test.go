@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readLiveEvents(t *testing.T, streamUrl string) []*LiveEvent {
+	// read the stream until the end event
+	resp, err := http.Get(streamUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream should be event stream, got %s", resp.Header.Get("Content-Type"))
+	}
+	var events []*LiveEvent
+	var scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line = scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event LiveEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, &event)
+		if event.State != "Running" {
+			break
+		}
+	}
+	return events
+}
+
+func Test_LiveHub(t *testing.T) {
+	var hub = NewLiveHub()
+	var ch = hub.Subscribe("job")
+	for i := 0; i < 20; i++ {
+		hub.Publish("job", &LiveEvent{State: "Running", Second: i})
+	}
+	hub.Publish("other", &LiveEvent{State: "End"})
+	hub.Publish("job", &LiveEvent{State: "End"})
+	var last *LiveEvent
+	for len(ch) > 0 {
+		last = <-ch
+	}
+	if last == nil || last.State != "End" {
+		t.Errorf("end event should be delivered even to slow subscribers, got %v", last)
+	}
+	hub.Unsubscribe("job", ch)
+	if len(hub.subscribers) != 0 {
+		t.Errorf("unsubscribed job should be removed")
+	}
+}
+
+func Test_LiveStream(t *testing.T) {
+	var h = setupTestServer()
+	var server = httptest.NewServer(h)
+	defer server.Close()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/boom/create", url.Values{"name": {"live"}}))
+	G_Store.UpdateBoomJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	if events := readLiveEvents(t, server.URL+"/api/boom/live?job_id="+jobId); len(events) != 1 || events[0].State != "Quiet" {
+		t.Errorf("quiet job should end the stream at once, got %v", events)
+	}
+	doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2", "2"},
+		"duration":    {"2", "1"},
+	})
+	var start = time.Now()
+	var events = readLiveEvents(t, server.URL+"/api/boom/live?job_id="+jobId)
+	if time.Since(start) > 10*time.Second || len(events) < 3 {
+		t.Fatalf("running job should stream seconds until it ends, got %d events", len(events))
+	}
+	var last = events[len(events)-1]
+	if last.State != "End" || last.LogId == "" {
+		t.Errorf("stream should end with final state, got %v", last)
+	}
+	var periods = make(map[int]bool)
+	for _, event := range events[:len(events)-1] {
+		periods[event.Period] = true
+	}
+	if events[0].Requests == 0 || events[0].P99 <= 0 || !periods[0] || !periods[1] {
+		t.Errorf("second events should carry stats and period, got %v %v", events[0], periods)
+	}
+	if w := doRequest(h, "GET", "/boom/live", url.Values{"job_id": {jobId}}); w.Code != 200 || !strings.Contains(w.Body.String(), "/api/boom/live?job_id="+jobId) {
+		t.Errorf("live page should subscribe the stream, got %d", w.Code)
+	}
+	jobId = createdJobId(t, doRequest(h, "POST", "/vegeta/create", url.Values{"name": {"live"}}))
+	if w := doRequest(h, "GET", "/vegeta/live", url.Values{"job_id": {jobId}}); w.Code != 200 {
+		t.Errorf("live page should render, got %d", w.Code)
+	}
+}
@@ -10,11 +10,25 @@ import (
 )
 
 func main() {
+	// command line client subcommands
+	if len(os.Args) > 1 && IsCommand(os.Args[1]) {
+		os.Exit(RunCommand(os.Args[1:]))
+	}
 	// load configuration file
 	LoadConfig()
 	// initialize Global Variables
 	InitGlobals()
+	// logs left running by the last process
+	RecoverInterruptedAttacks()
 
+	m := BuildMartini()
+	// Let's fly
+	os.Setenv("HOST", G_AlexHost)
+	os.Setenv("PORT", fmt.Sprintf("%d", G_AlexPort))
+	m.Run()
+}
+
+func BuildMartini() *martini.ClassicMartini {
 	// build martini
 	m := martini.Classic()
 	staticOptions := martini.StaticOptions{Prefix: "static"}
@@ -27,12 +41,45 @@ func main() {
 	m.Get("/", func(r render.Render) {
 		r.Redirect("/vegeta/")
 	})
+	m.Get("/metrics", GetPrometheusMetrics)
 	m.Group("/api", func(r martini.Router) {
 		r.Get("/system", GetSystemStatus)
 		r.Get("/vegeta/state", GetVegetaJobState)
 		r.Get("/boom/state", GetBoomJobState)
+		r.Get("/vegeta/live", StreamVegetaLive)
+		r.Get("/boom/live", StreamBoomLive)
 		r.Post("/param/test", TestParam)
 	})
+	m.Group("/api/v1", func(r martini.Router) {
+		r.Get("/agents", ApiGetAgents)
+		r.Post("/agents", ApiRegisterAgent)
+		r.Get("/vegeta/jobs", ApiGetVegetaJobs)
+		r.Post("/vegeta/jobs", ApiCreateVegetaJob)
+		r.Get("/vegeta/jobs/:id", ApiGetVegetaJob)
+		r.Put("/vegeta/jobs/:id", ApiUpdateVegetaJob)
+		r.Delete("/vegeta/jobs/:id", ApiDeleteVegetaJob)
+		r.Post("/vegeta/jobs/:id/run", ApiRunVegetaJob)
+		r.Post("/vegeta/jobs/:id/stop", ApiStopVegetaJob)
+		r.Get("/vegeta/logs", ApiGetVegetaLogs)
+		r.Get("/vegeta/logs/:id", ApiGetVegetaLog)
+		r.Delete("/vegeta/logs/:id", ApiDeleteVegetaLog)
+		r.Get("/vegeta/compare", ApiCompareVegetaLogs)
+		r.Post("/vegeta/logs/:id/baseline", ApiPinVegetaLog)
+		r.Delete("/vegeta/jobs/:id/baseline", ApiUnpinVegetaJob)
+		r.Get("/boom/jobs", ApiGetBoomJobs)
+		r.Post("/boom/jobs", ApiCreateBoomJob)
+		r.Get("/boom/jobs/:id", ApiGetBoomJob)
+		r.Put("/boom/jobs/:id", ApiUpdateBoomJob)
+		r.Delete("/boom/jobs/:id", ApiDeleteBoomJob)
+		r.Post("/boom/jobs/:id/run", ApiRunBoomJob)
+		r.Post("/boom/jobs/:id/stop", ApiStopBoomJob)
+		r.Get("/boom/logs", ApiGetBoomLogs)
+		r.Get("/boom/logs/:id", ApiGetBoomLog)
+		r.Delete("/boom/logs/:id", ApiDeleteBoomLog)
+		r.Get("/boom/compare", ApiCompareBoomLogs)
+		r.Post("/boom/logs/:id/baseline", ApiPinBoomLog)
+		r.Delete("/boom/jobs/:id/baseline", ApiUnpinBoomJob)
+	})
 	m.Group("/vegeta", func(r martini.Router) {
 		r.Get("/", GetVegetaJobs)
 		r.Post("/create", CreateVegetaJob)
@@ -44,7 +91,13 @@ func main() {
 		r.Get("/stop", StopVegetaJob)
 		r.Get("/logs", GetVegetaLogs)
 		r.Get("/log/delete", DeleteVegetaLog)
+		r.Get("/log/export", ExportVegetaLog)
+		r.Get("/log/report", ExportVegetaReport)
+		r.Get("/log/pin", PinVegetaLog)
+		r.Get("/unpin", UnpinVegetaJob)
 		r.Get("/metrics", GetVegetaMetrics)
+		r.Get("/compare", GetVegetaComparison)
+		r.Get("/live", GetVegetaLive)
 	})
 	m.Group("/boom", func(r martini.Router) {
 		r.Get("/", GetBoomJobs)
@@ -57,10 +110,13 @@ func main() {
 		r.Get("/stop", StopBoomJob)
 		r.Get("/logs", GetBoomLogs)
 		r.Get("/log/delete", DeleteBoomLog)
+		r.Get("/log/export", ExportBoomLog)
+		r.Get("/log/report", ExportBoomReport)
+		r.Get("/log/pin", PinBoomLog)
+		r.Get("/unpin", UnpinBoomJob)
 		r.Get("/metrics", GetBoomMetrics)
+		r.Get("/compare", GetBoomComparison)
+		r.Get("/live", GetBoomLive)
 	})
-	// Let's fly
-	os.Setenv("HOST", G_AlexHost)
-	os.Setenv("PORT", fmt.Sprintf("%d", G_AlexPort))
-	m.Run()
+	return m
 }
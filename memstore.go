@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+)
+
+type MemoryKV struct {
+	// volatile storage living inside the process, all data is lost on exit
+	buckets map[string]map[string][]byte
+	mutex   sync.RWMutex
+}
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{buckets: map[string]map[string][]byte{}}
+}
+
+func (kv *MemoryKV) Close() error {
+	return nil
+}
+
+func (kv *MemoryKV) Get(bucket string, key string) ([]byte, error) {
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+	var value, ok = kv.buckets[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (kv *MemoryKV) Put(bucket string, key string, value []byte) error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+	if kv.buckets[bucket] == nil {
+		kv.buckets[bucket] = map[string][]byte{}
+	}
+	kv.buckets[bucket][key] = value
+	return nil
+}
+
+func (kv *MemoryKV) Modify(bucket string, key string, fn func(value []byte) ([]byte, error)) error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+	var value, ok = kv.buckets[bucket][key]
+	if !ok {
+		return ErrNotFound
+	}
+	value, err := fn(value)
+	if err != nil {
+		return err
+	}
+	kv.buckets[bucket][key] = value
+	return nil
+}
+
+func (kv *MemoryKV) Delete(bucket string, key string) error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+	if _, ok := kv.buckets[bucket][key]; !ok {
+		return ErrNotFound
+	}
+	delete(kv.buckets[bucket], key)
+	return nil
+}
+
+func (kv *MemoryKV) ForEach(bucket string, fn func(value []byte) error) error {
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+	for _, value := range kv.buckets[bucket] {
+		err := fn(value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
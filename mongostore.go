@@ -0,0 +1,223 @@
+package main
+
+import (
+	"regexp"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type MongoStore struct {
+	// job storage using MongoDB collections
+	session *mgo.Session
+	db      *mgo.Database
+}
+
+func NewMongoStore(url string) (*MongoStore, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	session.SetMode(mgo.Monotonic, true)
+	return &MongoStore{session, session.DB("alex")}, nil
+}
+
+func (s *MongoStore) Close() {
+	s.session.Close()
+}
+
+func jobQuery(cond JobCondition) bson.M {
+	var query = bson.M{}
+	if cond.Team != "" {
+		query["team"] = cond.Team
+	}
+	if cond.Project != "" {
+		query["project"] = cond.Project
+	}
+	if cond.UrlPrefix != "" {
+		query["url"] = bson.M{"$regex": bson.RegEx{Pattern: "^" + regexp.QuoteMeta(cond.UrlPrefix)}}
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	return query
+}
+
+func logQuery(cond LogCondition) bson.M {
+	var query = bson.M{}
+	if cond.JobId != "" {
+		query["jobid"] = cond.JobId
+	}
+	if cond.State != "" {
+		query["state"] = cond.State
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	return query
+}
+
+func (s *MongoStore) count(collection string, query bson.M) (int, error) {
+	return s.db.C(collection).Find(query).Count()
+}
+
+func (s *MongoStore) find(collection string, query bson.M, sort string, offset int, limit int, result interface{}) error {
+	return s.db.C(collection).Find(query).Sort(sort).Skip(offset).Limit(limit).All(result)
+}
+
+func (s *MongoStore) get(collection string, id string, result interface{}) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrNotFound
+	}
+	err := s.db.C(collection).FindId(bson.ObjectIdHex(id)).One(result)
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *MongoStore) update(collection string, id string, changed bson.M) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrNotFound
+	}
+	err := s.db.C(collection).UpdateId(bson.ObjectIdHex(id), bson.M{"$set": changed})
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *MongoStore) remove(collection string, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrNotFound
+	}
+	err := s.db.C(collection).RemoveId(bson.ObjectIdHex(id))
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *MongoStore) CountVegetaJobs(cond JobCondition) (int, error) {
+	return s.count("vegeta_jobs", jobQuery(cond))
+}
+
+func (s *MongoStore) FindVegetaJobs(cond JobCondition, offset int, limit int) ([]VegetaJob, error) {
+	var jobs []VegetaJob
+	err := s.find("vegeta_jobs", jobQuery(cond), "-lastrunts", offset, limit, &jobs)
+	return jobs, err
+}
+
+func (s *MongoStore) GetVegetaJob(jobId string) (*VegetaJob, error) {
+	var job VegetaJob
+	err := s.get("vegeta_jobs", jobId, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *MongoStore) InsertVegetaJob(job *VegetaJob) error {
+	return s.db.C("vegeta_jobs").Insert(job)
+}
+
+func (s *MongoStore) UpdateVegetaJob(jobId string, changed bson.M) error {
+	return s.update("vegeta_jobs", jobId, changed)
+}
+
+func (s *MongoStore) RemoveVegetaJob(jobId string) error {
+	return s.remove("vegeta_jobs", jobId)
+}
+
+func (s *MongoStore) CountVegetaLogs(cond LogCondition) (int, error) {
+	return s.count("vegeta_logs", logQuery(cond))
+}
+
+func (s *MongoStore) FindVegetaLogs(cond LogCondition, offset int, limit int) ([]AttackVegetaLog, error) {
+	var logs []AttackVegetaLog
+	err := s.find("vegeta_logs", logQuery(cond), "-startts", offset, limit, &logs)
+	return logs, err
+}
+
+func (s *MongoStore) GetVegetaLog(logId string) (*AttackVegetaLog, error) {
+	var lg AttackVegetaLog
+	err := s.get("vegeta_logs", logId, &lg)
+	if err != nil {
+		return nil, err
+	}
+	return &lg, nil
+}
+
+func (s *MongoStore) InsertVegetaLog(lg *AttackVegetaLog) error {
+	return s.db.C("vegeta_logs").Insert(lg)
+}
+
+func (s *MongoStore) UpdateVegetaLog(logId string, changed bson.M) error {
+	return s.update("vegeta_logs", logId, changed)
+}
+
+func (s *MongoStore) RemoveVegetaLog(logId string) error {
+	return s.remove("vegeta_logs", logId)
+}
+
+func (s *MongoStore) CountBoomJobs(cond JobCondition) (int, error) {
+	return s.count("boom_jobs", jobQuery(cond))
+}
+
+func (s *MongoStore) FindBoomJobs(cond JobCondition, offset int, limit int) ([]BoomJob, error) {
+	var jobs []BoomJob
+	err := s.find("boom_jobs", jobQuery(cond), "-lastrunts", offset, limit, &jobs)
+	return jobs, err
+}
+
+func (s *MongoStore) GetBoomJob(jobId string) (*BoomJob, error) {
+	var job BoomJob
+	err := s.get("boom_jobs", jobId, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *MongoStore) InsertBoomJob(job *BoomJob) error {
+	return s.db.C("boom_jobs").Insert(job)
+}
+
+func (s *MongoStore) UpdateBoomJob(jobId string, changed bson.M) error {
+	return s.update("boom_jobs", jobId, changed)
+}
+
+func (s *MongoStore) RemoveBoomJob(jobId string) error {
+	return s.remove("boom_jobs", jobId)
+}
+
+func (s *MongoStore) CountBoomLogs(cond LogCondition) (int, error) {
+	return s.count("boom_logs", logQuery(cond))
+}
+
+func (s *MongoStore) FindBoomLogs(cond LogCondition, offset int, limit int) ([]AttackBoomLog, error) {
+	var logs []AttackBoomLog
+	err := s.find("boom_logs", logQuery(cond), "-startts", offset, limit, &logs)
+	return logs, err
+}
+
+func (s *MongoStore) GetBoomLog(logId string) (*AttackBoomLog, error) {
+	var lg AttackBoomLog
+	err := s.get("boom_logs", logId, &lg)
+	if err != nil {
+		return nil, err
+	}
+	return &lg, nil
+}
+
+func (s *MongoStore) InsertBoomLog(lg *AttackBoomLog) error {
+	return s.db.C("boom_logs").Insert(lg)
+}
+
+func (s *MongoStore) UpdateBoomLog(logId string, changed bson.M) error {
+	return s.update("boom_logs", logId, changed)
+}
+
+func (s *MongoStore) RemoveBoomLog(logId string) error {
+	return s.remove("boom_logs", logId)
+}
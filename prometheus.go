@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Prometheus text exposition of running jobs, counters of a job accumulate across runs
+
+var exporterLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type JobMetrics struct {
+	// updated by attacking workers without locking, counters first for 64-bit alignment
+	requests int64
+	errors   int64
+	rate     int64 // requests of the last finished second
+	target   int64 // current rate for vegeta, concurrency for boom
+	sum      int64 // microseconds
+	buckets  []int64
+	Engine   string
+	JobId    string
+	JobName  string
+}
+
+func (m *JobMetrics) Observe(latency time.Duration, success bool) {
+	atomic.AddInt64(&m.requests, 1)
+	if !success {
+		atomic.AddInt64(&m.errors, 1)
+	}
+	atomic.AddInt64(&m.sum, int64(latency/time.Microsecond))
+	var seconds = latency.Seconds()
+	for i, bound := range exporterLatencyBuckets {
+		if seconds <= bound {
+			atomic.AddInt64(&m.buckets[i], 1)
+			return
+		}
+	}
+}
+
+func (m *JobMetrics) ObserveHistogram(latencies *Histogram, requests int, failures int) {
+	// results collected elsewhere, each bucket counted at its highest latency,
+	// requests without latency like transport errors of boom count in +Inf only
+	atomic.AddInt64(&m.requests, int64(requests))
+	atomic.AddInt64(&m.errors, int64(failures))
+	atomic.AddInt64(&m.sum, latencies.Sum)
+	for i, count := range latencies.Counts {
+		if count == 0 {
+			continue
+		}
+		var seconds = float64(histogramHighest(i)) / 1e6
+		for k, bound := range exporterLatencyBuckets {
+			if seconds <= bound {
+				atomic.AddInt64(&m.buckets[k], count)
+				break
+			}
+		}
+	}
+}
+
+func (m *JobMetrics) SetRate(requests int) {
+	atomic.StoreInt64(&m.rate, int64(requests))
+}
+
+func (m *JobMetrics) SetTarget(target int64) {
+	atomic.StoreInt64(&m.target, target)
+}
+
+type Exporter struct {
+	jobs  map[string]*JobMetrics
+	mutex sync.Mutex
+}
+
+func NewExporter() *Exporter {
+	return &Exporter{jobs: make(map[string]*JobMetrics)}
+}
+
+func (e *Exporter) Job(engine string, jobId string, jobName string) *JobMetrics {
+	// metrics of the job, created on first run
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var key = engine + ":" + jobId
+	var m, ok = e.jobs[key]
+	if !ok {
+		m = &JobMetrics{Engine: engine, JobId: jobId, buckets: make([]int64, len(exporterLatencyBuckets))}
+		e.jobs[key] = m
+	}
+	m.JobName = jobName
+	return m
+}
+
+func (e *Exporter) Forget(engine string, jobId string) {
+	// drop metrics of deleted jobs
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.jobs, engine+":"+jobId)
+}
+
+func (e *Exporter) sortedJobs() ([]*JobMetrics, []string) {
+	// jobs in stable order with their labels
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var jobs []*JobMetrics
+	for _, m := range e.jobs {
+		jobs = append(jobs, m)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Engine != jobs[j].Engine {
+			return jobs[i].Engine < jobs[j].Engine
+		}
+		return jobs[i].JobId < jobs[j].JobId
+	})
+	var labels = make([]string, len(jobs))
+	for i, m := range jobs {
+		labels[i] = fmt.Sprintf(`engine="%s",job_id="%s",job_name="%s"`, m.Engine, m.JobId, escapeLabel(m.JobName))
+	}
+	return jobs, labels
+}
+
+func escapeLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+func (e *Exporter) WriteText(buffer *bytes.Buffer) {
+	buffer.WriteString("# HELP alex_running_jobs Jobs attacking now.\n# TYPE alex_running_jobs gauge\n")
+	buffer.WriteString(fmt.Sprintf("alex_running_jobs{engine=\"vegeta\"} %d\n", G_RunningVegetaJobs.Size()))
+	buffer.WriteString(fmt.Sprintf("alex_running_jobs{engine=\"boom\"} %d\n", G_RunningBoomJobs.Size()))
+	var jobs, labels = e.sortedJobs()
+	var write = func(name string, kind string, help string, value func(m *JobMetrics) int64, engine string) {
+		buffer.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind))
+		for i, m := range jobs {
+			if engine == "" || m.Engine == engine {
+				buffer.WriteString(fmt.Sprintf("%s{%s} %d\n", name, labels[i], value(m)))
+			}
+		}
+	}
+	write("alex_job_requests_total", "counter", "Requests finished by the job.", func(m *JobMetrics) int64 {
+		return atomic.LoadInt64(&m.requests)
+	}, "")
+	write("alex_job_errors_total", "counter", "Requests failed by the job.", func(m *JobMetrics) int64 {
+		return atomic.LoadInt64(&m.errors)
+	}, "")
+	write("alex_job_requests_per_second", "gauge", "Requests finished in the last second.", func(m *JobMetrics) int64 {
+		return atomic.LoadInt64(&m.rate)
+	}, "")
+	write("alex_job_current_rate", "gauge", "Attacking qps of running vegeta jobs.", func(m *JobMetrics) int64 {
+		return atomic.LoadInt64(&m.target)
+	}, "vegeta")
+	write("alex_job_current_concurrency", "gauge", "Attacking concurrency of running boom jobs.", func(m *JobMetrics) int64 {
+		return atomic.LoadInt64(&m.target)
+	}, "boom")
+	buffer.WriteString("# HELP alex_job_latency_seconds Response time of the job.\n# TYPE alex_job_latency_seconds histogram\n")
+	for i, m := range jobs {
+		var cumulative int64
+		for k, bound := range exporterLatencyBuckets {
+			cumulative += atomic.LoadInt64(&m.buckets[k])
+			buffer.WriteString(fmt.Sprintf("alex_job_latency_seconds_bucket{%s,le=\"%v\"} %d\n", labels[i], bound, cumulative))
+		}
+		var count = atomic.LoadInt64(&m.requests)
+		buffer.WriteString(fmt.Sprintf("alex_job_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels[i], count))
+		buffer.WriteString(fmt.Sprintf("alex_job_latency_seconds_sum{%s} %v\n", labels[i], float64(atomic.LoadInt64(&m.sum))/1e6))
+		buffer.WriteString(fmt.Sprintf("alex_job_latency_seconds_count{%s} %d\n", labels[i], count))
+	}
+}
+
+func GetPrometheusMetrics(w http.ResponseWriter) {
+	var buffer bytes.Buffer
+	G_Exporter.WriteText(&buffer)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buffer.Bytes())
+}
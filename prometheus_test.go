@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ExporterWriteText(t *testing.T) {
+	var exporter = NewExporter()
+	var m = exporter.Job("vegeta", "j1", `a "quoted" name`)
+	m.Observe(2*time.Millisecond, true)
+	m.Observe(20*time.Millisecond, false)
+	m.Observe(time.Minute, true)
+	m.SetRate(3)
+	m.SetTarget(100)
+	exporter.Job("boom", "j2", "b").SetTarget(8)
+	if exporter.Job("vegeta", "j1", "renamed") != m {
+		t.Errorf("metrics of a job should be kept across runs")
+	}
+
+	var buffer bytes.Buffer
+	exporter.WriteText(&buffer)
+	var text = buffer.String()
+	var labels = `engine="vegeta",job_id="j1",job_name="renamed"`
+	for _, line := range []string{
+		`alex_job_requests_total{` + labels + `} 3`,
+		`alex_job_errors_total{` + labels + `} 1`,
+		`alex_job_requests_per_second{` + labels + `} 3`,
+		`alex_job_current_rate{` + labels + `} 100`,
+		`alex_job_current_concurrency{engine="boom",job_id="j2",job_name="b"} 8`,
+		`alex_job_latency_seconds_bucket{` + labels + `,le="0.001"} 0`,
+		`alex_job_latency_seconds_bucket{` + labels + `,le="0.005"} 1`,
+		`alex_job_latency_seconds_bucket{` + labels + `,le="0.025"} 2`,
+		`alex_job_latency_seconds_bucket{` + labels + `,le="10"} 2`,
+		`alex_job_latency_seconds_bucket{` + labels + `,le="+Inf"} 3`,
+		`alex_job_latency_seconds_count{` + labels + `} 3`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("exposition should contain %s, got\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, `alex_job_current_rate{engine="boom"`) {
+		t.Errorf("boom jobs should not report current rate")
+	}
+	if escapeLabel(`a "b"\`+"\n") != `a \"b\"\\\n` {
+		t.Errorf("label values should be escaped, got %s", escapeLabel(`a "b"\`+"\n"))
+	}
+
+	// 2 of 5 merged boom requests failed without a response
+	var histogram = NewHistogram()
+	for i := 0; i < 3; i++ {
+		histogram.Record(2 * time.Millisecond)
+	}
+	exporter.Job("boom", "j2", "b").ObserveHistogram(histogram, 5, 2)
+	buffer.Reset()
+	exporter.WriteText(&buffer)
+	for _, line := range []string{
+		`alex_job_requests_total{engine="boom",job_id="j2",job_name="b"} 5`,
+		`alex_job_errors_total{engine="boom",job_id="j2",job_name="b"} 2`,
+		`alex_job_latency_seconds_bucket{engine="boom",job_id="j2",job_name="b",le="10"} 3`,
+		`alex_job_latency_seconds_count{engine="boom",job_id="j2",job_name="b"} 5`,
+	} {
+		if !strings.Contains(buffer.String(), line+"\n") {
+			t.Errorf("merged results should count every request, missing %s", line)
+		}
+	}
+
+	exporter.Forget("vegeta", "j1")
+	buffer.Reset()
+	exporter.WriteText(&buffer)
+	if strings.Contains(buffer.String(), `job_id="j1"`) {
+		t.Errorf("forgotten job should not be exported")
+	}
+}
+
+func Test_PrometheusEndpoint(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/boom/create", url.Values{"name": {"exported"}}))
+	G_Store.UpdateBoomJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2"},
+		"duration":    {"1"},
+	})
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+
+	var w = doRequest(h, "GET", "/metrics", url.Values{})
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("metrics should be served as text, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var text = w.Body.String()
+	if !strings.Contains(text, "alex_running_jobs{engine=\"boom\"} 0\n") {
+		t.Errorf("finished job should not be running, got\n%s", text)
+	}
+	var labels = fmt.Sprintf(`engine="boom",job_id="%s",job_name="exported"`, jobId)
+	if !strings.Contains(text, "alex_job_requests_total{"+labels+"} ") ||
+		strings.Contains(text, "alex_job_requests_total{"+labels+"} 0\n") {
+		t.Errorf("requests of the job should be counted, got\n%s", text)
+	}
+	if !strings.Contains(text, "alex_job_current_concurrency{"+labels+"} 0\n") {
+		t.Errorf("concurrency of finished job should be reset, got\n%s", text)
+	}
+
+	doRequest(h, "GET", "/boom/delete", url.Values{"job_id": {jobId}})
+	if w = doRequest(h, "GET", "/metrics", url.Values{}); strings.Contains(w.Body.String(), jobId) {
+		t.Errorf("deleted job should not be exported")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Reconcile attacks left behind by a process which crashed or was restarted
+
+func RecoverInterruptedAttacks() {
+	// running logs and current rates in the store belong to no process after restart
+	vegetaLogs, err := G_Store.FindVegetaLogs(LogCondition{State: "Running"}, 0, 0)
+	if err != nil {
+		log.Panic(err)
+	}
+	for i := range vegetaLogs {
+		var lg = &vegetaLogs[i]
+		if G_RunningVegetaJobs.Exists(lg.JobId) {
+			continue
+		}
+		LogAttackVegetaInterrupted(lg)
+		log.Printf("vegeta log %s interrupted after %d periods", lg.Id.Hex(), len(lg.MetricsList))
+	}
+	vegetaJobs, err := G_Store.FindVegetaJobs(JobCondition{}, 0, 0)
+	if err != nil {
+		log.Panic(err)
+	}
+	for _, job := range vegetaJobs {
+		if job.CurrentRate != 0 && !G_RunningVegetaJobs.Exists(job.Id.Hex()) {
+			G_Store.UpdateVegetaJob(job.Id.Hex(), bson.M{"currentrate": 0})
+		}
+	}
+
+	boomLogs, err := G_Store.FindBoomLogs(LogCondition{State: "Running"}, 0, 0)
+	if err != nil {
+		log.Panic(err)
+	}
+	for i := range boomLogs {
+		var lg = &boomLogs[i]
+		if G_RunningBoomJobs.Exists(lg.JobId) {
+			continue
+		}
+		LogAttackBoomInterrupted(lg)
+		log.Printf("boom log %s interrupted after %d periods", lg.Id.Hex(), len(lg.MetricsList))
+	}
+	boomJobs, err := G_Store.FindBoomJobs(JobCondition{}, 0, 0)
+	if err != nil {
+		log.Panic(err)
+	}
+	for _, job := range boomJobs {
+		if job.CurrentConcurrency != 0 && !G_RunningBoomJobs.Exists(job.Id.Hex()) {
+			G_Store.UpdateBoomJob(job.Id.Hex(), bson.M{"currentconcurrency": 0})
+		}
+	}
+}
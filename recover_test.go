@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test_RecoverInterruptedAttacks(t *testing.T) {
+	setupTestServer()
+	var finished = &AttackVegetaLog{Id: bson.NewObjectId(), State: "End", EndTs: 1, MetricsList: []*vegeta.Metrics{{Requests: 100, Success: 1}}}
+	var job = NewVegetaJob("crashed", "go", "alex")
+	job.Thresholds = Thresholds{MinSuccessRatio: 99}
+	job.BaselineLogId = finished.Id.Hex()
+	job.LastRegression = &Regression{BaselineLogId: "previous", Failures: []string{}}
+	job.CurrentRate = 100
+	G_Store.InsertVegetaJob(job)
+	finished.JobId = job.Id.Hex()
+	G_Store.InsertVegetaLog(finished)
+	var lg = &AttackVegetaLog{
+		Id:          bson.NewObjectId(),
+		JobId:       job.Id.Hex(),
+		JobDetail:   job,
+		State:       "Running",
+		StartTs:     time.Now().Unix(),
+		MetricsList: []*vegeta.Metrics{{Requests: 100, Success: 0.5}},
+	}
+	G_Store.InsertVegetaLog(lg)
+	var boomJob = NewBoomJob("crashed", "go", "alex")
+	boomJob.CurrentConcurrency = 10
+	G_Store.InsertBoomJob(boomJob)
+	var boomLog = &AttackBoomLog{Id: bson.NewObjectId(), JobId: boomJob.Id.Hex(), State: "Running"}
+	G_Store.InsertBoomLog(boomLog)
+
+	RecoverInterruptedAttacks()
+	recovered, _ := G_Store.GetVegetaLog(lg.Id.Hex())
+	if recovered.State != "Interrupted" || recovered.EndTs == 0 || len(recovered.MetricsList) != 1 {
+		t.Errorf("running log should be interrupted with its periods, got %s %d", recovered.State, recovered.EndTs)
+	}
+	if recovered.Verdict != nil || recovered.Regression != nil {
+		t.Errorf("interrupted attack should not be judged, got %v %v", recovered.Verdict, recovered.Regression)
+	}
+	if untouched, _ := G_Store.GetVegetaLog(finished.Id.Hex()); untouched.State != "End" || untouched.EndTs != 1 {
+		t.Errorf("finished logs should be kept, got %s", untouched.State)
+	}
+	if reset, _ := G_Store.GetVegetaJob(job.Id.Hex()); reset.CurrentRate != 0 || reset.LastRegression == nil || reset.LastRegression.BaselineLogId != "previous" {
+		t.Errorf("current rate should be reset and last regression kept, got %d %v", reset.CurrentRate, reset.LastRegression)
+	}
+	if recoveredBoom, _ := G_Store.GetBoomLog(boomLog.Id.Hex()); recoveredBoom.State != "Interrupted" {
+		t.Errorf("running boom log should be interrupted, got %s", recoveredBoom.State)
+	}
+	if reset, _ := G_Store.GetBoomJob(boomJob.Id.Hex()); reset.CurrentConcurrency != 0 {
+		t.Errorf("current concurrency should be reset, got %d", reset.CurrentConcurrency)
+	}
+}
+
+func Test_PeriodsPersistedDuringAttack(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/boom/create", url.Values{"name": {"flush"}}))
+	G_Store.UpdateBoomJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2", "2"},
+		"duration":    {"1", "10"},
+	})
+	defer waitJobDone(t, G_RunningBoomJobs, jobId)
+	defer StopBoomAttack(jobId)
+	var deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		logs, _ := G_Store.FindBoomLogs(LogCondition{JobId: jobId}, 0, 0)
+		if len(logs) == 1 && len(logs[0].MetricsList) == 1 {
+			if logs[0].State != "Running" || logs[0].MetricsList[0].Requests == 0 {
+				t.Errorf("completed period should be stored while running, got %s %v", logs[0].State, logs[0].MetricsList[0])
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("completed period should be stored before the attack ends")
+}
+
+func Test_SeriesPersistedDuringPeriod(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+	defer func(interval time.Duration) { G_LogFlushInterval = interval }(G_LogFlushInterval)
+	G_LogFlushInterval = 200 * time.Millisecond
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/boom/create", url.Values{"name": {"flush"}}))
+	G_Store.UpdateBoomJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2"},
+		"duration":    {"10"},
+	})
+	defer waitJobDone(t, G_RunningBoomJobs, jobId)
+	defer StopBoomAttack(jobId)
+	var deadline = time.Now().Add(6 * time.Second)
+	for time.Now().Before(deadline) {
+		logs, _ := G_Store.FindBoomLogs(LogCondition{JobId: jobId}, 0, 0)
+		if len(logs) == 1 && len(logs[0].Series) > 0 {
+			if logs[0].State != "Running" || len(logs[0].MetricsList) != 0 || logs[0].Series[0].Requests == 0 {
+				t.Errorf("seconds should be stored during the period, got %s %v", logs[0].State, logs[0].Series[0])
+			}
+			var w = doRequest(h, "GET", "/boom/metrics", url.Values{"log_id": {logs[0].Id.Hex()}})
+			if !strings.Contains(w.Body.String(), "0 periods completed") || !strings.Contains(w.Body.String(), "location.reload") {
+				t.Errorf("metrics page should show partial results")
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("seconds should be stored before the period ends")
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Push per-second attack metrics to external time series databases
+
+var sinkQueueSize = 1024 // seconds buffered while the database is slow, newer ones are dropped beyond
+var sinkDialTimeout = 3 * time.Second
+var sinkWriteTimeout = 3 * time.Second
+
+type SinkConfig struct {
+	// Protocol is "influx" line protocol or "graphite" plaintext, Network is "udp" or "tcp"
+	Protocol string
+	Network  string
+	Address  string
+	Prefix   string // influx measurement or graphite path prefix, defaults to alex
+}
+
+type SinkTags struct {
+	// identify the attack in the database
+	Engine  string
+	JobId   string
+	Team    string
+	Project string
+	Host    string
+}
+
+func NewSinkTags(engine string, jobId string, team string, project string, hosts []string) SinkTags {
+	return SinkTags{Engine: engine, JobId: jobId, Team: team, Project: project, Host: strings.Join(hosts, ",")}
+}
+
+type MetricsSink struct {
+	// written by attacking jobs, delivered by one goroutine so attack is never blocked
+	config SinkConfig
+	lines  chan []byte
+	done   chan bool
+	conn   net.Conn
+}
+
+func NewMetricsSink(config SinkConfig) (*MetricsSink, error) {
+	// connection is made on first write, the database may come up later
+	if config.Protocol == "" {
+		config.Protocol = "influx"
+	}
+	if config.Network == "" {
+		config.Network = "udp"
+	}
+	if config.Prefix == "" {
+		config.Prefix = "alex"
+	}
+	if config.Protocol != "influx" && config.Protocol != "graphite" {
+		return nil, fmt.Errorf("metrics sink protocol must be influx or graphite, got %s", config.Protocol)
+	}
+	if config.Network != "udp" && config.Network != "tcp" {
+		return nil, fmt.Errorf("metrics sink network must be udp or tcp, got %s", config.Network)
+	}
+	if config.Address == "" {
+		return nil, errors.New("metrics sink address is required")
+	}
+	var sink = &MetricsSink{config: config, lines: make(chan []byte, sinkQueueSize), done: make(chan bool)}
+	go sink.run()
+	return sink, nil
+}
+
+func (s *MetricsSink) Write(tags SinkTags, start time.Time, stats *SecondStats) {
+	// stats of one second since attack start
+	var at = start.Add(time.Duration(stats.Second) * time.Second)
+	var payload []byte
+	if s.config.Protocol == "graphite" {
+		payload = FormatGraphite(s.config.Prefix, tags, at, stats)
+	} else {
+		payload = FormatInflux(s.config.Prefix, tags, at, stats)
+	}
+	select {
+	case s.lines <- payload:
+	default:
+		log.Printf("metrics sink queue full, second %d of job %s dropped", stats.Second, tags.JobId)
+	}
+}
+
+func (s *MetricsSink) Close() {
+	// deliver queued metrics and disconnect
+	close(s.lines)
+	<-s.done
+}
+
+func (s *MetricsSink) run() {
+	for payload := range s.lines {
+		s.send(payload)
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	close(s.done)
+}
+
+func (s *MetricsSink) send(payload []byte) {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.config.Network, s.config.Address, sinkDialTimeout)
+		if err != nil {
+			log.Printf("metrics sink connect %s fail: %v", s.config.Address, err)
+			return
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(sinkWriteTimeout))
+	if _, err := s.conn.Write(payload); err != nil {
+		// reconnect on next write
+		log.Printf("metrics sink write %s fail: %v", s.config.Address, err)
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func sinkStatusCodes(stats *SecondStats) []string {
+	var codes []string
+	for code := range stats.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func FormatInflux(measurement string, tags SinkTags, at time.Time, stats *SecondStats) []byte {
+	// one line, latencies in milliseconds, timestamp in nanoseconds
+	var buffer bytes.Buffer
+	buffer.WriteString(influxTagEscaper.Replace(measurement))
+	for _, tag := range [][2]string{
+		{"engine", tags.Engine},
+		{"host", tags.Host},
+		{"job_id", tags.JobId},
+		{"period", fmt.Sprint(stats.Period)},
+		{"project", tags.Project},
+		{"team", tags.Team},
+	} {
+		// empty tag values are not allowed
+		if tag[1] != "" {
+			buffer.WriteString("," + tag[0] + "=" + influxTagEscaper.Replace(tag[1]))
+		}
+	}
+	buffer.WriteString(fmt.Sprintf(" requests=%di,successes=%di,errors=%di,mean=%v,p50=%v,p95=%v,p99=%v",
+		stats.Requests, stats.Successes, stats.Requests-stats.Successes,
+		stats.Mean.Seconds()*1000, stats.P50.Seconds()*1000, stats.P95.Seconds()*1000, stats.P99.Seconds()*1000))
+	for _, code := range sinkStatusCodes(stats) {
+		buffer.WriteString(fmt.Sprintf(",status_%s=%di", code, stats.StatusCodes[code]))
+	}
+	buffer.WriteString(fmt.Sprintf(" %d\n", at.UnixNano()))
+	return buffer.Bytes()
+}
+
+var graphiteUnsafe = regexp.MustCompile(`[^A-Za-z0-9_\-]+`)
+
+func graphiteNode(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return graphiteUnsafe.ReplaceAllString(value, "_")
+}
+
+func FormatGraphite(prefix string, tags SinkTags, at time.Time, stats *SecondStats) []byte {
+	// prefix.engine.team.project.job_id.host.period_N.metric value timestamp
+	var path = strings.Join([]string{
+		prefix,
+		graphiteNode(tags.Engine),
+		graphiteNode(tags.Team),
+		graphiteNode(tags.Project),
+		graphiteNode(tags.JobId),
+		graphiteNode(tags.Host),
+		fmt.Sprintf("period_%d", stats.Period),
+	}, ".")
+	var buffer bytes.Buffer
+	var write = func(name string, value interface{}) {
+		buffer.WriteString(fmt.Sprintf("%s.%s %v %d\n", path, name, value, at.Unix()))
+	}
+	write("requests", stats.Requests)
+	write("successes", stats.Successes)
+	write("errors", stats.Requests-stats.Successes)
+	write("mean", stats.Mean.Seconds()*1000)
+	write("p50", stats.P50.Seconds()*1000)
+	write("p95", stats.P95.Seconds()*1000)
+	write("p99", stats.P99.Seconds()*1000)
+	for _, code := range sinkStatusCodes(stats) {
+		write("status_"+code, stats.StatusCodes[code])
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_FormatSinkLines(t *testing.T) {
+	var tags = NewSinkTags("vegeta", "j1", "go team", "alex", []string{"a:80", "b:80"})
+	var stats = &SecondStats{Second: 2, Period: 1, Requests: 10, Successes: 9, Mean: 1500 * time.Microsecond,
+		P50: time.Millisecond, P95: 2 * time.Millisecond, P99: 3 * time.Millisecond, StatusCodes: map[string]int{"200": 9, "500": 1}}
+	var at = time.Unix(1000, 0)
+
+	var line = string(FormatInflux("alex", tags, at, stats))
+	var expected = `alex,engine=vegeta,host=a:80\,b:80,job_id=j1,period=1,project=alex,team=go\ team ` +
+		"requests=10i,successes=9i,errors=1i,mean=1.5,p50=1,p95=2,p99=3,status_200=9i,status_500=1i 1000000000000\n"
+	if line != expected {
+		t.Errorf("influx line should be\n%sgot\n%s", expected, line)
+	}
+
+	var lines = strings.Split(string(FormatGraphite("alex", tags, at, stats)), "\n")
+	if len(lines) != 10 || lines[0] != "alex.vegeta.go_team.alex.j1.a_80_b_80.period_1.requests 10 1000" ||
+		lines[8] != "alex.vegeta.go_team.alex.j1.a_80_b_80.period_1.status_500 1 1000" {
+		t.Errorf("graphite lines should be tagged by path, got %v", lines)
+	}
+}
+
+func Test_NewMetricsSinkValidate(t *testing.T) {
+	for _, config := range []SinkConfig{
+		{Protocol: "statsd", Address: "localhost:1"},
+		{Network: "unix", Address: "localhost:1"},
+		{},
+	} {
+		if _, err := NewMetricsSink(config); err == nil {
+			t.Errorf("invalid sink config should be refused, got %v", config)
+		}
+	}
+}
+
+func Test_MetricsSinkUdp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := NewMetricsSink(SinkConfig{Address: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags = NewSinkTags("boom", "j2", "go", "alex", []string{"localhost"})
+	sink.Write(tags, time.Unix(1000, 0), &SecondStats{Requests: 3, Successes: 3, StatusCodes: map[string]int{}})
+	sink.Close()
+
+	var buffer = make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buffer[:n]), "alex,engine=boom,host=localhost,job_id=j2,period=0,") {
+		t.Errorf("influx line should be sent over udp, got %s", buffer[:n])
+	}
+}
+
+func Test_MetricsSinkDuringAttack(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var received = make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		var scanner = bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+	G_MetricsSink, err = NewMetricsSink(SinkConfig{Protocol: "graphite", Network: "tcp", Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { G_MetricsSink = nil }()
+
+	var jobId = createdJobId(t, doRequest(h, "POST", "/boom/create", url.Values{"name": {"sink"}, "team": {"go"}, "project": {"alex"}}))
+	G_Store.UpdateBoomJob(jobId, map[string]interface{}{"hosts": []string{target.Host()}, "method": "GET", "url": "/ping"})
+	doRequest(h, "POST", "/boom/run", url.Values{
+		"job_id":      {jobId},
+		"timeout":     {"5"},
+		"concurrency": {"2", "2"},
+		"duration":    {"1", "1"},
+	})
+	waitJobDone(t, G_RunningBoomJobs, jobId)
+	G_MetricsSink.Close()
+
+	var lines []string
+	select {
+	case lines = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metrics should be pushed over tcp")
+	}
+	var periods = make(map[string]bool)
+	for _, line := range lines {
+		var prefix = "alex.boom.go.alex." + jobId + "."
+		if !strings.HasPrefix(line, prefix) {
+			t.Fatalf("metrics should be tagged by job, got %s", line)
+		}
+		periods[strings.Split(strings.TrimPrefix(line, prefix), ".")[1]] = true
+	}
+	if !periods["period_0"] || !periods["period_1"] {
+		t.Errorf("metrics of every period should be pushed, got %v", lines)
+	}
+}
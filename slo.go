@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+type Thresholds struct {
+	// pass/fail settings for each period, zero value disables the check
+	MaxP99Latency   float64 // max p99 latency in milliseconds
+	MinSuccessRatio float64 // min success ratio in percent
+	MaxErrors       int     // max failed requests
+	MinQps          float64 // min achieved qps
+}
+
+type Verdict struct {
+	Passed   bool
+	Failures []string
+}
+
+func (t Thresholds) IsEmpty() bool {
+	return t == Thresholds{}
+}
+
+func (t Thresholds) Validate(errs FieldErrors) {
+	// check thresholds along with job settings
+	if t.MaxP99Latency < 0 || t.MaxErrors < 0 || t.MinQps < 0 {
+		errs.Add("Thresholds", "thresholds must not be negative")
+	}
+	if t.MinSuccessRatio < 0 || t.MinSuccessRatio > 100 {
+		errs.Add("Thresholds", "success ratio must be between 0 and 100")
+	}
+}
+
+func (t Thresholds) Check(p99 float64, successRatio float64, errors int, qps float64) *Verdict {
+	// judge one period, latency in milliseconds and success ratio in percent
+	var verdict = &Verdict{Passed: true, Failures: []string{}}
+	if t.MaxP99Latency > 0 && p99 > t.MaxP99Latency {
+		verdict.Failures = append(verdict.Failures, fmt.Sprintf("p99 latency %.2fms > %.2fms", p99, t.MaxP99Latency))
+	}
+	if t.MinSuccessRatio > 0 && successRatio < t.MinSuccessRatio {
+		verdict.Failures = append(verdict.Failures, fmt.Sprintf("success ratio %.2f%% < %.2f%%", successRatio, t.MinSuccessRatio))
+	}
+	if t.MaxErrors > 0 && errors > t.MaxErrors {
+		verdict.Failures = append(verdict.Failures, fmt.Sprintf("errors %d > %d", errors, t.MaxErrors))
+	}
+	if t.MinQps > 0 && qps < t.MinQps {
+		verdict.Failures = append(verdict.Failures, fmt.Sprintf("qps %.2f < %.2f", qps, t.MinQps))
+	}
+	verdict.Passed = len(verdict.Failures) == 0
+	return verdict
+}
+
+func VegetaErrorCount(metrics *vegeta.Metrics) int {
+	// requests not answered with a successful status
+	return int(metrics.Requests) - int(math.Floor(metrics.Success*float64(metrics.Requests)+0.5))
+}
+
+func BoomErrorCount(report *Report) int {
+	var count = 0
+	for _, n := range report.ErrorDist {
+		count += n
+	}
+	return count
+}
+
+func (t Thresholds) CheckVegeta(metrics *vegeta.Metrics) *Verdict {
+	var p99 = metrics.Latencies.P99.Seconds() * 1000
+	return t.Check(p99, metrics.Success*100, VegetaErrorCount(metrics), metrics.Rate)
+}
+
+func (t Thresholds) CheckBoom(report *Report) *Verdict {
+	var p99 = report.Latency_P99.Seconds() * 1000
+	return t.Check(p99, report.SuccessRatio, BoomErrorCount(report), report.Qps)
+}
+
+func MergeVerdicts(verdicts []*Verdict) *Verdict {
+	// overall verdict fails when any period fails
+	var overall = &Verdict{Passed: true, Failures: []string{}}
+	for i, verdict := range verdicts {
+		for _, failure := range verdict.Failures {
+			overall.Failures = append(overall.Failures, fmt.Sprintf("period %d: %s", i+1, failure))
+		}
+	}
+	overall.Passed = len(overall.Failures) == 0
+	return overall
+}
+
+func (v *Verdict) String() string {
+	if v.Passed {
+		return "PASS"
+	}
+	return "FAIL: " + strings.Join(v.Failures, ", ")
+}
+
+func ParseThresholdsForm(req *http.Request) Thresholds {
+	// read thresholds from job edit form, empty inputs disable the check
+	var t Thresholds
+	t.MaxP99Latency, _ = strconv.ParseFloat(req.FormValue("max_p99_latency"), 64)
+	t.MinSuccessRatio, _ = strconv.ParseFloat(req.FormValue("min_success_ratio"), 64)
+	t.MaxErrors, _ = strconv.Atoi(req.FormValue("max_errors"))
+	t.MinQps, _ = strconv.ParseFloat(req.FormValue("min_qps"), 64)
+	return t
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/lib"
+)
+
+func Test_ThresholdsCheck(t *testing.T) {
+	var thresholds = Thresholds{MaxP99Latency: 100, MinSuccessRatio: 99, MaxErrors: 5, MinQps: 50}
+	if verdict := thresholds.Check(80, 100, 0, 60); !verdict.Passed {
+		t.Errorf("period within thresholds should pass, got %v", verdict)
+	}
+	var verdict = thresholds.Check(120, 90, 10, 40)
+	if verdict.Passed || len(verdict.Failures) != 4 {
+		t.Errorf("every broken threshold should be reported, got %v", verdict)
+	}
+	if verdict = (Thresholds{}).Check(10000, 0, 1000, 0); !verdict.Passed {
+		t.Errorf("empty thresholds should pass, got %v", verdict)
+	}
+
+	var metrics = &vegeta.Metrics{Requests: 100, Success: 0.97, Rate: 100}
+	metrics.Latencies.P99 = 20 * time.Millisecond
+	verdict = Thresholds{MaxErrors: 2}.CheckVegeta(metrics)
+	if verdict.Passed || VegetaErrorCount(metrics) != 3 {
+		t.Errorf("failed vegeta requests should be counted, got %v", verdict)
+	}
+	var report = &Report{Qps: 10, SuccessRatio: 100, Latency_P99: 2 * time.Second, ErrorDist: map[string]int{"timeout": 1}}
+	verdict = Thresholds{MaxP99Latency: 1000}.CheckBoom(report)
+	if verdict.Passed || BoomErrorCount(report) != 1 {
+		t.Errorf("slow boom period should fail, got %v", verdict)
+	}
+
+	var overall = MergeVerdicts([]*Verdict{{Passed: true}, {Passed: false, Failures: []string{"qps 1 < 2"}}})
+	if overall.Passed || overall.Failures[0] != "period 2: qps 1 < 2" {
+		t.Errorf("overall verdict should fail with period failures, got %v", overall)
+	}
+	var errs = FieldErrors{}
+	Thresholds{MinSuccessRatio: 120}.Validate(errs)
+	if len(errs["Thresholds"]) == 0 {
+		t.Errorf("success ratio over 100 should be rejected")
+	}
+}
+
+func Test_VegetaJobVerdict(t *testing.T) {
+	var h = setupTestServer()
+	var target = newTestTarget()
+	defer target.Close()
+
+	var job = NewVegetaJob("slo", "go", "alex")
+	job.Url = "/ping"
+	job.Hosts = []string{target.Host()}
+	job.Workers = 2
+	job.Periods = []RatePeriod{{10, 1}, {20, 1}}
+	job.Thresholds = Thresholds{MinSuccessRatio: 99, MinQps: 15}
+	G_Store.InsertVegetaJob(job)
+	lg, err := StartVegetaJob(job, "slo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobDone(t, G_RunningVegetaJobs, job.Id.Hex())
+
+	lg, _ = G_Store.GetVegetaLog(lg.Id.Hex())
+	if len(lg.Verdicts) != 2 || lg.Verdict == nil {
+		t.Fatalf("verdicts should be recorded, got %v %v", lg.Verdicts, lg.Verdict)
+	}
+	if lg.Verdicts[0].Passed || !lg.Verdicts[1].Passed || lg.Verdict.Passed {
+		t.Errorf("first period should miss the qps threshold, got %v %v %v", lg.Verdicts[0], lg.Verdicts[1], lg.Verdict)
+	}
+	var w = doRequest(h, "GET", "/vegeta/metrics", url.Values{"log_id": {lg.Id.Hex()}})
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "FAIL") {
+		t.Errorf("metrics page should show the verdict, got %d", w.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/martini-contrib/render"
+)
+
+// Render a report page into one html file readable without alex server
+
+var standaloneStaticDir = "static"
+var standaloneStyles = []string{"css/bootstrap.min.css", "css/dashboard.css"}
+var standaloneScripts = []string{"js/jquery.min.js", "js/bootstrap.min.js", "js/dygraph.min.js"}
+
+// glyphicons are loaded from files next to the css, replaced by embedded fonts
+var glyphiconsFontFace = regexp.MustCompile(`@font-face\{font-family:'Glyphicons Halflings';[^}]*\}`)
+
+func readStaticFiles(names []string) (string, error) {
+	var buffer bytes.Buffer
+	for _, name := range names {
+		content, err := ioutil.ReadFile(filepath.Join(standaloneStaticDir, name))
+		if err != nil {
+			return "", err
+		}
+		buffer.Write(content)
+		buffer.WriteString("\n")
+	}
+	return buffer.String(), nil
+}
+
+func embeddedFontFace() (string, error) {
+	var sources []string
+	for _, format := range []string{"woff2", "woff"} {
+		content, err := ioutil.ReadFile(filepath.Join(standaloneStaticDir, "fonts", "glyphicons-halflings-regular."+format))
+		if err != nil {
+			return "", err
+		}
+		sources = append(sources, fmt.Sprintf("url(data:font/%s;base64,%s) format('%s')",
+			format, base64.StdEncoding.EncodeToString(content), format))
+	}
+	return "@font-face{font-family:'Glyphicons Halflings';src:" + strings.Join(sources, ",") + "}", nil
+}
+
+func StandaloneAssets() (template.CSS, template.JS, error) {
+	// styles and scripts inlined into the page
+	styles, err := readStaticFiles(standaloneStyles)
+	if err != nil {
+		return "", "", err
+	}
+	fontFace, err := embeddedFontFace()
+	if err != nil {
+		return "", "", err
+	}
+	styles = glyphiconsFontFace.ReplaceAllLiteralString(styles, fontFace)
+	scripts, err := readStaticFiles(standaloneScripts)
+	if err != nil {
+		return "", "", err
+	}
+	// a literal end tag would close the inline script early
+	scripts = strings.Replace(scripts, "</script", `<\/script`, -1)
+	return template.CSS(styles), template.JS(scripts), nil
+}
+
+func RenderStandalone(w http.ResponseWriter, r render.Render, tmpl string, context map[string]interface{}, filename string) {
+	// the report page without navigation and links back to alex
+	styles, scripts, err := StandaloneAssets()
+	if err != nil {
+		log.Panic(err)
+	}
+	context["standalone"] = true
+	context["inlineStyles"] = styles
+	context["inlineScripts"] = scripts
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	r.HTML(200, tmpl, context, render.HTMLOptions{Layout: "standalone"})
+}
+
+func ExportVegetaReport(w http.ResponseWriter, req *http.Request, r render.Render) {
+	lg, err := G_Store.GetVegetaLog(req.FormValue("log_id"))
+	if err != nil {
+		log.Panic(err)
+	}
+	var context = make(map[string]interface{})
+	context["log"] = lg
+	RenderStandalone(w, r, "vegeta_metrics", context, fmt.Sprintf("alex-vegeta-%s.html", lg.Id.Hex()))
+}
+
+func ExportBoomReport(w http.ResponseWriter, req *http.Request, r render.Render) {
+	lg, err := G_Store.GetBoomLog(req.FormValue("log_id"))
+	if err != nil {
+		log.Panic(err)
+	}
+	var context = make(map[string]interface{})
+	context["log"] = lg
+	RenderStandalone(w, r, "boom_metrics", context, fmt.Sprintf("alex-boom-%s.html", lg.Id.Hex()))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Returned by stores when the requested job or log does not exist
+var ErrNotFound = errors.New("not found")
+
+type JobCondition struct {
+	// filters for listing jobs, empty fields match everything
+	Team      string
+	Project   string
+	UrlPrefix string
+}
+
+func (cond JobCondition) Match(team string, project string, url string) bool {
+	if cond.Team != "" && cond.Team != team {
+		return false
+	}
+	if cond.Project != "" && cond.Project != project {
+		return false
+	}
+	return strings.HasPrefix(url, cond.UrlPrefix)
+}
+
+type LogCondition struct {
+	// filters for listing attack logs, empty fields match everything
+	JobId string
+	State string
+}
+
+func (cond LogCondition) Match(jobId string, state string) bool {
+	if cond.State != "" && cond.State != state {
+		return false
+	}
+	return cond.JobId == "" || cond.JobId == jobId
+}
+
+type Store interface {
+	// storage backend for jobs and attack logs of both engines,
+	// changed maps use the lowercased bson field names of the documents
+	CountVegetaJobs(cond JobCondition) (int, error)
+	FindVegetaJobs(cond JobCondition, offset int, limit int) ([]VegetaJob, error)
+	GetVegetaJob(jobId string) (*VegetaJob, error)
+	InsertVegetaJob(job *VegetaJob) error
+	UpdateVegetaJob(jobId string, changed bson.M) error
+	RemoveVegetaJob(jobId string) error
+
+	CountVegetaLogs(cond LogCondition) (int, error)
+	FindVegetaLogs(cond LogCondition, offset int, limit int) ([]AttackVegetaLog, error)
+	GetVegetaLog(logId string) (*AttackVegetaLog, error)
+	InsertVegetaLog(lg *AttackVegetaLog) error
+	UpdateVegetaLog(logId string, changed bson.M) error
+	RemoveVegetaLog(logId string) error
+
+	CountBoomJobs(cond JobCondition) (int, error)
+	FindBoomJobs(cond JobCondition, offset int, limit int) ([]BoomJob, error)
+	GetBoomJob(jobId string) (*BoomJob, error)
+	InsertBoomJob(job *BoomJob) error
+	UpdateBoomJob(jobId string, changed bson.M) error
+	RemoveBoomJob(jobId string) error
+
+	CountBoomLogs(cond LogCondition) (int, error)
+	FindBoomLogs(cond LogCondition, offset int, limit int) ([]AttackBoomLog, error)
+	GetBoomLog(logId string) (*AttackBoomLog, error)
+	InsertBoomLog(lg *AttackBoomLog) error
+	UpdateBoomLog(logId string, changed bson.M) error
+	RemoveBoomLog(logId string) error
+
+	Close()
+}
+
+// Open the storage backend selected by configuration
+func OpenStore(storage string) Store {
+	switch storage {
+	case "", "mongo":
+		store, err := NewMongoStore(G_MongoUrl)
+		if err != nil {
+			log.Panic(err)
+		}
+		return store
+	case "bolt":
+		kv, err := OpenBoltKV(G_BoltPath)
+		if err != nil {
+			log.Panic(err)
+		}
+		return NewDocStore(kv)
+	case "memory":
+		return NewDocStore(NewMemoryKV())
+	}
+	log.Panicf("unknown storage backend %s", storage)
+	return nil
+}
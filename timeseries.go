@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-second statistics collected during attack
+
+var seriesOpenSeconds = 2 // seconds kept open for late results before percentiles are computed
+
+type SecondStats struct {
+	// results of one period finished in one second, Second is the offset from attack start,
+	// a second spanning two periods has stats for each
+	Second      int
+	Period      int
+	Requests    int
+	Successes   int
+	Mean        time.Duration
+	P50         time.Duration
+	P95         time.Duration
+	P99         time.Duration
+	StatusCodes map[string]int
+}
+
+type seriesKey struct {
+	second int
+	period int
+}
+
+type seriesBucket struct {
+	stats     *SecondStats
+	latencies *Histogram
+}
+
+type TimeSeriesCollector struct {
+	// shared by attacking workers, open buckets are bounded so memory stays constant
+	start   time.Time
+	open    map[seriesKey]*seriesBucket
+	closed  TimeSeries
+	free    []*Histogram
+	current int
+	// called with a copy of each closed second, outside of the lock
+	onSecond func(stats *SecondStats)
+	done     chan bool
+	mutex    sync.Mutex
+}
+
+func NewTimeSeriesCollector(start time.Time) *TimeSeriesCollector {
+	return &TimeSeriesCollector{start: start, open: make(map[seriesKey]*seriesBucket)}
+}
+
+func (c *TimeSeriesCollector) Run(onSecond func(stats *SecondStats)) {
+	// close seconds every second even without results, onSecond receives them
+	c.onSecond = onSecond
+	c.done = make(chan bool)
+	go func() {
+		var ticker = time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				c.advance(int(now.Sub(c.start) / time.Second))
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+func (c *TimeSeriesCollector) advance(second int) {
+	c.mutex.Lock()
+	var closed []*SecondStats
+	if second > c.current {
+		c.current = second
+		closed = c.closeBefore(second - seriesOpenSeconds + 1)
+	}
+	c.mutex.Unlock()
+	c.notify(closed)
+}
+
+func (c *TimeSeriesCollector) notify(closed []*SecondStats) {
+	if c.onSecond == nil {
+		return
+	}
+	for _, stats := range closed {
+		c.onSecond(stats)
+	}
+}
+
+func (c *TimeSeriesCollector) Record(at time.Time, period int, latency time.Duration, code int, success bool) {
+	// period is the index of the period the request was sent in
+	var second = int(at.Sub(c.start) / time.Second)
+	if second < 0 {
+		second = 0
+	}
+	c.advance(second)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var key = seriesKey{second, period}
+	var bucket, ok = c.open[key]
+	if !ok {
+		if stats := c.closedStats(second, period); stats != nil {
+			// too late for percentiles, still counted
+			stats.add(code, success)
+			return
+		}
+		bucket = &seriesBucket{stats: &SecondStats{Second: second, Period: period, StatusCodes: make(map[string]int)}}
+		if n := len(c.free); n > 0 {
+			bucket.latencies, c.free = c.free[n-1], c.free[:n-1]
+		} else {
+			bucket.latencies = NewHistogram()
+		}
+		c.open[key] = bucket
+	}
+	bucket.stats.add(code, success)
+	bucket.latencies.Record(latency)
+}
+
+func (s *SecondStats) add(code int, success bool) {
+	s.Requests++
+	if success {
+		s.Successes++
+	}
+	if code != 0 {
+		s.StatusCodes[strconv.Itoa(code)]++
+	}
+}
+
+func (s *SecondStats) copy() *SecondStats {
+	// snapshot for readers outside of the lock
+	var stats = *s
+	stats.StatusCodes = make(map[string]int, len(s.StatusCodes))
+	for code, count := range s.StatusCodes {
+		stats.StatusCodes[code] = count
+	}
+	return &stats
+}
+
+func (c *TimeSeriesCollector) closedStats(second int, period int) *SecondStats {
+	for i := len(c.closed) - 1; i >= 0; i-- {
+		if c.closed[i].Second == second && c.closed[i].Period == period {
+			return c.closed[i]
+		}
+		if c.closed[i].Second < second {
+			break
+		}
+	}
+	return nil
+}
+
+func (c *TimeSeriesCollector) closeBefore(second int) []*SecondStats {
+	// compute percentiles of finished seconds and recycle their histograms
+	var closed []*SecondStats
+	var keys []seriesKey
+	for key := range c.open {
+		if key.second < second {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].second < keys[j].second || (keys[i].second == keys[j].second && keys[i].period < keys[j].period)
+	})
+	for _, key := range keys {
+		var bucket = c.open[key]
+		bucket.stats.Mean = bucket.latencies.Mean()
+		bucket.stats.P50 = bucket.latencies.Quantile(0.5)
+		bucket.stats.P95 = bucket.latencies.Quantile(0.95)
+		bucket.stats.P99 = bucket.latencies.Quantile(0.99)
+		bucket.latencies.Reset()
+		c.free = append(c.free, bucket.latencies)
+		c.closed = append(c.closed, bucket.stats)
+		closed = append(closed, bucket.stats.copy())
+		delete(c.open, key)
+	}
+	return closed
+}
+
+func (c *TimeSeriesCollector) Close() TimeSeries {
+	// close all seconds, the collector is not used afterwards
+	if c.done != nil {
+		close(c.done)
+	}
+	c.mutex.Lock()
+	var closed = c.closeBefore(c.current + 1)
+	c.mutex.Unlock()
+	c.notify(closed)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed.sort()
+	return c.closed
+}
+
+func (c *TimeSeriesCollector) Closed() TimeSeries {
+	// copy of the seconds closed so far, the collector keeps running
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var series = make(TimeSeries, 0, len(c.closed))
+	for _, stats := range c.closed {
+		series = append(series, stats.copy())
+	}
+	series.sort()
+	return series
+}
+
+func (c *TimeSeriesCollector) AddSeconds(seconds TimeSeries, offset int) {
+	// seconds collected elsewhere, offset is their start in seconds since attack start
+	var added []*SecondStats
+	c.mutex.Lock()
+	for _, stats := range seconds {
+		var second = stats.Second + offset
+		if closed := c.closedStats(second, stats.Period); closed != nil {
+			mergeSecondStats(closed, stats)
+			added = append(added, closed.copy())
+			continue
+		}
+		var copied = stats.copy()
+		copied.Second = second
+		c.closed = append(c.closed, copied)
+		added = append(added, copied.copy())
+		if second > c.current {
+			c.current = second
+		}
+	}
+	c.mutex.Unlock()
+	c.notify(added)
+}
+
+func mergeSecondStats(s *SecondStats, other *SecondStats) {
+	// counts are exact, percentiles are the highest of both
+	if s.Requests+other.Requests > 0 {
+		s.Mean = time.Duration((int64(s.Mean)*int64(s.Requests) + int64(other.Mean)*int64(other.Requests)) /
+			int64(s.Requests+other.Requests))
+	}
+	s.Requests += other.Requests
+	s.Successes += other.Successes
+	for code, count := range other.StatusCodes {
+		s.StatusCodes[code] += count
+	}
+	if other.P50 > s.P50 {
+		s.P50 = other.P50
+	}
+	if other.P95 > s.P95 {
+		s.P95 = other.P95
+	}
+	if other.P99 > s.P99 {
+		s.P99 = other.P99
+	}
+}
+
+func MergeTimeSeries(lists []TimeSeries) TimeSeries {
+	// series of processes attacking together, aligned by second and period
+	var index = make(map[seriesKey]*SecondStats)
+	var merged TimeSeries
+	for _, series := range lists {
+		for _, stats := range series {
+			var key = seriesKey{stats.Second, stats.Period}
+			if existing, ok := index[key]; ok {
+				mergeSecondStats(existing, stats)
+				continue
+			}
+			var copied = stats.copy()
+			index[key] = copied
+			merged = append(merged, copied)
+		}
+	}
+	merged.sort()
+	return merged
+}
+
+type TimeSeries []*SecondStats
+
+func (t TimeSeries) sort() {
+	sort.SliceStable(t, func(i, j int) bool {
+		return t[i].Second < t[j].Second || (t[i].Second == t[j].Second && t[i].Period < t[j].Period)
+	})
+}
+
+func (t TimeSeries) bySecond() TimeSeries {
+	// seconds spanning two periods are charted once
+	var merged TimeSeries
+	for _, stats := range t {
+		if n := len(merged); n > 0 && merged[n-1].Second == stats.Second {
+			mergeSecondStats(merged[n-1], stats)
+			continue
+		}
+		merged = append(merged, stats.copy())
+	}
+	return merged
+}
+
+func (t TimeSeries) ChartRequests() string {
+	var buffer bytes.Buffer
+	for _, stats := range t.bySecond() {
+		buffer.WriteString(fmt.Sprintf("%v,%v,%v\n", stats.Second, stats.Requests, stats.Successes))
+	}
+	return buffer.String()
+}
+
+func (t TimeSeries) ChartLatency() string {
+	// latencies in milliseconds
+	var buffer bytes.Buffer
+	for _, stats := range t.bySecond() {
+		buffer.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v\n", stats.Second,
+			stats.Mean.Seconds()*1000, stats.P50.Seconds()*1000, stats.P95.Seconds()*1000, stats.P99.Seconds()*1000))
+	}
+	return buffer.String()
+}
+
+func (t TimeSeries) StatusCodesList() []string {
+	var seen = make(map[string]bool)
+	var codes []string
+	for _, stats := range t {
+		for code := range stats.StatusCodes {
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func (t TimeSeries) ChartStatusCodesLabels() string {
+	var codes = t.StatusCodesList()
+	if len(codes) == 0 {
+		return "Time,None"
+	}
+	return "Time," + strings.Join(codes, ",")
+}
+
+func (t TimeSeries) ChartStatusCodes() string {
+	var codes = t.StatusCodesList()
+	var buffer bytes.Buffer
+	for _, stats := range t.bySecond() {
+		buffer.WriteString(strconv.Itoa(stats.Second))
+		for _, code := range codes {
+			buffer.WriteString(fmt.Sprintf(",%v", stats.StatusCodes[code]))
+		}
+		if len(codes) == 0 {
+			buffer.WriteString(",0")
+		}
+		buffer.WriteString("\n")
+	}
+	return buffer.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_TimeSeriesCollector(t *testing.T) {
+	var start = time.Unix(1000, 0)
+	var c = NewTimeSeriesCollector(start)
+	for i := 0; i < 10; i++ {
+		c.Record(start.Add(time.Duration(i)*100*time.Millisecond), 0, 10*time.Millisecond, 200, true)
+	}
+	for i := 0; i < 10; i++ {
+		c.Record(start.Add(time.Second+time.Duration(i)*100*time.Millisecond), 1, 20*time.Millisecond, 500, false)
+	}
+	c.Record(start.Add(5*time.Second), 1, 30*time.Millisecond, 0, false)
+	// second 0 is closed by now, late results are still counted
+	c.Record(start.Add(500*time.Millisecond), 0, time.Hour, 200, true)
+	var series = c.Close()
+	if len(series) != 3 || series[0].Second != 0 || series[1].Second != 1 || series[2].Second != 5 {
+		t.Fatalf("series should have a point for each second with results, got %v", series)
+	}
+	if series[0].Requests != 11 || series[0].Successes != 11 || series[0].StatusCodes["200"] != 11 || series[0].P99 != 10*time.Millisecond {
+		t.Errorf("first second should count late result without latency, got %+v", series[0])
+	}
+	if series[1].Period != 1 || series[1].Successes != 0 || series[1].StatusCodes["500"] != 10 || series[1].Mean != 20*time.Millisecond {
+		t.Errorf("second period should be recorded, got %+v", series[1])
+	}
+	if len(series[2].StatusCodes) != 0 || series[2].Requests != 1 {
+		t.Errorf("failed request without status should be counted, got %+v", series[2])
+	}
+	if series.ChartStatusCodesLabels() != "Time,200,500" {
+		t.Errorf("status codes should be labelled, got %s", series.ChartStatusCodesLabels())
+	}
+	if lines := strings.Split(strings.TrimSpace(series.ChartStatusCodes()), "\n"); len(lines) != 3 || lines[1] != "1,0,10" {
+		t.Errorf("status codes chart should have a row for each second, got %v", lines)
+	}
+	if lines := strings.Split(strings.TrimSpace(series.ChartLatency()), "\n"); lines[0] != "0,10,10,10,10" {
+		t.Errorf("latency chart should be in milliseconds, got %v", lines)
+	}
+	if TimeSeries(nil).ChartStatusCodesLabels() != "Time,None" {
+		t.Errorf("empty series should still have labels")
+	}
+}
+
+func Test_TimeSeriesPeriodBoundary(t *testing.T) {
+	var start = time.Unix(1000, 0)
+	var c = NewTimeSeriesCollector(start)
+	// the next period starts before a slow response of the previous one finishes
+	c.Record(start.Add(1100*time.Millisecond), 1, 10*time.Millisecond, 200, true)
+	c.Record(start.Add(1200*time.Millisecond), 0, 30*time.Millisecond, 200, true)
+	c.Record(start.Add(1300*time.Millisecond), 1, 10*time.Millisecond, 200, true)
+	var series = c.Close()
+	if len(series) != 2 || series[0].Period != 0 || series[0].Requests != 1 || series[1].Period != 1 || series[1].Requests != 2 {
+		t.Fatalf("results should be counted in the period they were sent in, got %v %v", series[0], series[1])
+	}
+	if lines := strings.Split(strings.TrimSpace(series.ChartRequests()), "\n"); len(lines) != 1 || lines[0] != "1,3,3" {
+		t.Errorf("charts should show the second once, got %v", lines)
+	}
+	var merged = MergeTimeSeries([]TimeSeries{series, series})
+	if len(merged) != 2 || merged[0].Requests != 2 || merged[1].Requests != 4 {
+		t.Errorf("merged series should keep periods apart, got %v", merged)
+	}
+}
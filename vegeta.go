@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/martini-contrib/render"
@@ -50,39 +51,185 @@ type VegetaJob struct {
 	Periods []RatePeriod
 	// current qps in running
 	CurrentRate uint64
+	// pass/fail thresholds for each period
+	Thresholds Thresholds
+	// expected response status codes
+	Assertions Assertions
+	// max sustainable qps search instead of periods, nil for stepping
+	Search *CapacitySearch
+	// pinned log later runs are compared against
+	BaselineLogId string
+	// allowed change against baseline
+	Tolerance Tolerance
+	// regression of the last run against baseline
+	LastRegression *Regression
+	// live rules aborting the attack on overload
+	AbortRules AbortRules
+	// attack from registered agents instead of this process
+	Distributed bool
 }
 
 func (job *VegetaJob) IsRunning() bool {
 	return G_RunningVegetaJobs.Exists(job.Id.Hex())
 }
 
+func NewVegetaJob(name string, team string, project string) *VegetaJob {
+	// new job with default settings
+	return &VegetaJob{
+		Id:        bson.NewObjectId(),
+		Name:      name,
+		Team:      team,
+		Hosts:     []string{"localhost:8000"},
+		Project:   project,
+		Method:    "GET",
+		Jsonified: false,
+		Seeds:     []RequestSeed{RequestSeed{}},
+		CreateTs:  time.Now().Unix(),
+		LastRunTs: time.Now().Unix(),
+		Workers:   100,
+		Timeout:   10,
+		Redirects: 1,
+		Keepalive: true,
+		Periods:   []RatePeriod{RatePeriod{10, 5}},
+		Tolerance: Tolerance{P99: 15},
+	}
+}
+
+func (job *VegetaJob) Validate() FieldErrors {
+	// check job settings before saving
+	var errs = FieldErrors{}
+	if job.Name == "" {
+		errs.Add("Name", "name is required")
+	}
+	if job.Url != "" && !strings.HasPrefix(job.Url, "/") {
+		errs.Add("Url", "url must start with /")
+	}
+	if !IsValidMethod(job.Method) {
+		errs.Add("Method", "unsupported http method")
+	}
+	for _, host := range job.Hosts {
+		if host == "" {
+			errs.Add("Hosts", "host:port must not be empty")
+		}
+	}
+	if len(job.Seeds) == 0 {
+		errs.Add("Seeds", "at least one parameter seed is required")
+	}
+	if job.Workers == 0 {
+		errs.Add("Workers", "workers must be positive")
+	}
+	if job.Timeout <= 0 {
+		errs.Add("Timeout", "timeout must be positive")
+	}
+	for _, period := range job.Periods {
+		if period.Rate == 0 || period.Duration == 0 {
+			errs.Add("Periods", "rate and duration must be positive")
+		}
+	}
+	job.Thresholds.Validate(errs)
+	job.Assertions.Validate(errs)
+	job.Tolerance.Validate(errs)
+	job.AbortRules.Validate(errs)
+	if job.Search != nil {
+		job.Search.Validate(errs)
+	}
+	if job.Assertions.NeedBody() {
+		errs.Add("Assertions", "vegeta results carry no response body, use a boom job for body assertions")
+	}
+	return errs
+}
+
+func (job *VegetaJob) ValidateRun() FieldErrors {
+	// check job is ready for attacking
+	var errs = job.Validate()
+	if job.Url == "" {
+		errs.Add("Url", "url is required")
+	}
+	if len(job.Hosts) == 0 {
+		errs.Add("Hosts", "at least one host:port is required")
+	}
+	if job.Search != nil {
+		delete(errs, "Periods")
+	} else if len(job.Periods) == 0 {
+		errs.Add("Periods", "at least one qps step is required")
+	}
+	if job.Distributed && len(G_Agents.Live()) == 0 {
+		errs.Add("Distributed", ErrNoAgents.Error())
+	}
+	return errs
+}
+
+func SaveVegetaJob(job *VegetaJob) error {
+	// persist user editable settings
+	var changed = bson.M{
+		"name":        job.Name,
+		"team":        job.Team,
+		"project":     job.Project,
+		"method":      job.Method,
+		"url":         job.Url,
+		"hosts":       job.Hosts,
+		"jsonified":   job.Jsonified,
+		"seeds":       job.Seeds,
+		"workers":     job.Workers,
+		"timeout":     job.Timeout,
+		"redirects":   job.Redirects,
+		"keepalive":   job.Keepalive,
+		"periods":     job.Periods,
+		"thresholds":  job.Thresholds,
+		"assertions":  job.Assertions,
+		"tolerance":   job.Tolerance,
+		"abortrules":  job.AbortRules,
+		"search":      job.Search,
+		"distributed": job.Distributed,
+	}
+	return G_Store.UpdateVegetaJob(job.Id.Hex(), changed)
+}
+
+func StartVegetaJob(job *VegetaJob, comment string) (*AttackVegetaLog, error) {
+	// persist run settings and start attacking in background
+	if job.Distributed && len(G_Agents.Live()) == 0 {
+		return nil, ErrNoAgents
+	}
+	if !G_RunningVegetaJobs.PutIfAbsent(job.Id.Hex()) {
+		return nil, ErrJobRunning
+	}
+	job.LastRunTs = time.Now().Unix()
+	var changed = bson.M{
+		"workers":     job.Workers,
+		"timeout":     job.Timeout,
+		"redirects":   job.Redirects,
+		"keepalive":   job.Keepalive,
+		"periods":     job.Periods,
+		"search":      job.Search,
+		"distributed": job.Distributed,
+		"lastrunts":   job.LastRunTs,
+	}
+	err := G_Store.UpdateVegetaJob(job.Id.Hex(), changed)
+	if err != nil {
+		G_RunningVegetaJobs.Delete(job.Id.Hex())
+		return nil, err
+	}
+	var lg = LogAttackVegetaStart(job, comment)
+	// the attack keeps writing to lg, callers get the log as started
+	var started = *lg
+	go AttackVegetaJob(job, lg)
+	return &started, nil
+}
+
 func GetVegetaJobs(req *http.Request, r render.Render) {
 	var team = req.FormValue("team")
 	var project = req.FormValue("project")
 	var url = req.FormValue("url")
 	var page = req.FormValue("p")
-	var condition = bson.M{}
-	if team != "" {
-		condition["team"] = team
-	}
-	if project != "" {
-		condition["project"] = project
-	}
-	if url != "" {
-		condition["url"] = bson.M{"$regex": bson.RegEx{fmt.Sprintf("^%s", url), ""}}
-	}
-	if len(condition) == 0 {
-		condition = nil
-	}
-	total, err := G_MongoDB.C("vegeta_jobs").Find(condition).Count()
+	var condition = JobCondition{team, project, url}
+	total, err := G_Store.CountVegetaJobs(condition)
 	if err != nil {
 		log.Panic(err)
 	}
 	var pager = NewPager(20, total)
 	pager.CurrentPage, err = strconv.Atoi(page)
 	pager.UrlPattern = fmt.Sprintf("/vegeta/?p=%%d&team=%s&project=%s", team, project)
-	var jobs []VegetaJob
-	err = G_MongoDB.C("vegeta_jobs").Find(condition).Skip(pager.Offset()).Sort("-lastrunts").Limit(pager.Limit()).All(&jobs)
+	jobs, err := G_Store.FindVegetaJobs(condition, pager.Offset(), pager.Limit())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -99,23 +246,8 @@ func CreateVegetaJob(req *http.Request, r render.Render) {
 	var name = req.FormValue("name")
 	var team = req.FormValue("team")
 	var project = req.FormValue("project")
-	var job = VegetaJob{
-		Id:        bson.NewObjectId(),
-		Name:      name,
-		Team:      team,
-		Hosts:     []string{"localhost:8000"},
-		Project:   project,
-		Jsonified: false,
-		Seeds:     []RequestSeed{RequestSeed{}},
-		CreateTs:  time.Now().Unix(),
-		LastRunTs: time.Now().Unix(),
-		Workers:   100,
-		Timeout:   10,
-		Redirects: 1,
-		Keepalive: true,
-		Periods:   []RatePeriod{RatePeriod{10, 5}},
-	}
-	err := G_MongoDB.C("vegeta_jobs").Insert(&job)
+	var job = NewVegetaJob(name, team, project)
+	err := G_Store.InsertVegetaJob(job)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -126,17 +258,21 @@ type VegetaEditForm struct {
 	Job     *VegetaJob
 	Methods []MethodSelector
 	Teams   []TeamSelector
+	Errors  FieldErrors
 }
 
 func EditVegetaJobPage(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
-	var job VegetaJob
-	err := G_MongoDB.C("vegeta_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetVegetaJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
+	renderVegetaEditForm(r, job, nil)
+}
+
+func renderVegetaEditForm(r render.Render, job *VegetaJob, errs FieldErrors) {
 	var context = make(map[string]interface{})
-	var form = VegetaEditForm{Job: &job}
+	var form = VegetaEditForm{Job: job, Errors: errs}
 	form.Methods = GenMethodSelectors(job.Method)
 	form.Teams = GenTeamSelectors(job.Team)
 	context["form"] = form
@@ -146,8 +282,7 @@ func EditVegetaJobPage(req *http.Request, r render.Render) {
 func EditVegetaJob(req *http.Request, r render.Render) {
 	req.ParseForm()
 	var jobId = req.FormValue("job_id")
-	var job VegetaJob
-	err := G_MongoDB.C("vegeta_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetVegetaJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -196,18 +331,16 @@ func EditVegetaJob(req *http.Request, r render.Render) {
 			job.Seeds[i].JsonData = jsonDataSeeds[i]
 		}
 	}
-	var changed = bson.M{
-		"name":      job.Name,
-		"team":      job.Team,
-		"project":   job.Project,
-		"method":    job.Method,
-		"url":       job.Url,
-		"hosts":     job.Hosts,
-		"jsonified": job.Jsonified,
-		"seeds":     job.Seeds,
-	}
-	var op = bson.M{"$set": changed}
-	err = G_MongoDB.C("vegeta_jobs").UpdateId(job.Id, op)
+	job.Thresholds = ParseThresholdsForm(req)
+	job.Assertions = ParseAssertionsForm(req)
+	job.Tolerance = ParseToleranceForm(req)
+	job.AbortRules = ParseAbortRulesForm(req)
+	if errs := job.Validate(); len(errs) > 0 {
+		// edited settings are kept in the form for fixing
+		renderVegetaEditForm(r, job, errs)
+		return
+	}
+	err = SaveVegetaJob(job)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -215,7 +348,15 @@ func EditVegetaJob(req *http.Request, r render.Render) {
 }
 
 type VegetaRunForm struct {
-	Job *VegetaJob
+	Job    *VegetaJob
+	Errors FieldErrors
+}
+
+func renderVegetaRunForm(r render.Render, job *VegetaJob, errs FieldErrors) {
+	var context = make(map[string]interface{})
+	context["form"] = VegetaRunForm{Job: job, Errors: errs}
+	context["agents"] = G_Agents.Live()
+	RenderTemplate(r, "vegeta_run", context)
 }
 
 func RunVegetaJobPage(req *http.Request, r render.Render) {
@@ -225,22 +366,17 @@ func RunVegetaJobPage(req *http.Request, r render.Render) {
 		r.Redirect(req.Referer())
 		return
 	}
-	var job VegetaJob
-	err := G_MongoDB.C("vegeta_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetVegetaJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
-	var form = VegetaRunForm{&job}
-	var context = make(map[string]interface{})
-	context["form"] = form
-	RenderTemplate(r, "vegeta_run", context)
+	renderVegetaRunForm(r, job, nil)
 }
 
 func RunVegetaJob(req *http.Request, r render.Render) {
 	req.ParseForm()
 	var jobId = req.FormValue("job_id")
-	var job VegetaJob
-	err := G_MongoDB.C("vegeta_jobs").FindId(bson.ObjectIdHex(jobId)).One(&job)
+	job, err := G_Store.GetVegetaJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -248,6 +384,7 @@ func RunVegetaJob(req *http.Request, r render.Render) {
 	var timeout, _ = strconv.Atoi(req.FormValue("timeout"))
 	var redirects, _ = strconv.Atoi(req.FormValue("redirects"))
 	var keepalive = req.FormValue("keepalive") != ""
+	var distributed = req.FormValue("distributed") != ""
 	var rates = req.Form["rate"]
 	var durations = req.Form["duration"]
 	var comment = req.FormValue("comment")
@@ -259,29 +396,35 @@ func RunVegetaJob(req *http.Request, r render.Render) {
 	}
 	job.Workers = uint64(workers)
 	job.Timeout = timeout
+	job.Redirects = redirects
+	job.Keepalive = keepalive
 	job.Periods = periods
-	var changed = bson.M{
-		"workers":   job.Workers,
-		"timeout":   job.Timeout,
-		"redirects": redirects,
-		"keepalive": keepalive,
-		"periods":   job.Periods,
-		"lastrunts": time.Now().Unix(),
-	}
-	var op = bson.M{"$set": changed}
-	err = G_MongoDB.C("vegeta_jobs").UpdateId(job.Id, op)
-	if err != nil {
+	job.Distributed = distributed
+	job.Search = nil
+	if req.FormValue("mode") == "search" {
+		job.Search = ParseCapacitySearchForm(req)
+	}
+	if errs := job.ValidateRun(); len(errs) > 0 {
+		// run settings are kept in the form for fixing
+		renderVegetaRunForm(r, job, errs)
+		return
+	}
+	_, err = StartVegetaJob(job, comment)
+	if err == ErrNoAgents {
+		renderVegetaRunForm(r, job, FieldErrors{"Distributed": {err.Error()}})
+		return
+	}
+	if err != nil && err != ErrJobRunning {
 		log.Panic(err)
 	}
-	G_RunningVegetaJobs.Put(job.Id.Hex())
-	go AttackVegetaJob(&job, comment)
 	r.Redirect("/vegeta/")
 }
 
 func DeleteVegetaJob(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
 	G_RunningVegetaJobs.Delete(jobId)
-	err := G_MongoDB.C("vegeta_jobs").RemoveId(bson.ObjectIdHex(jobId))
+	G_Exporter.Forget("vegeta", jobId)
+	err := G_Store.RemoveVegetaJob(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -292,7 +435,7 @@ func StopVegetaJob(req *http.Request, r render.Render) {
 	// stop vegeta jobs
 	var jobId = req.FormValue("job_id")
 	if G_RunningVegetaJobs.Exists(jobId) {
-		G_StoppingVegetaJobs.Put(jobId)
+		StopVegetaAttack(jobId)
 	}
 	r.Redirect(req.Referer())
 }
@@ -300,34 +443,54 @@ func StopVegetaJob(req *http.Request, r render.Render) {
 func GetVegetaLogs(req *http.Request, r render.Render) {
 	var jobId = req.FormValue("job_id")
 	var page = req.FormValue("p")
-	var logs []AttackVegetaLog
-	var condition = bson.M{}
-	if jobId != "" {
-		condition = bson.M{"jobid": jobId}
-	} else {
-		condition = nil
-	}
-	total, err := G_MongoDB.C("vegeta_logs").Find(condition).Count()
+	var condition = LogCondition{JobId: jobId}
+	total, err := G_Store.CountVegetaLogs(condition)
 	if err != nil {
 		log.Panic(err)
 	}
 	var pager = NewPager(20, total)
 	pager.CurrentPage, err = strconv.Atoi(page)
 	pager.UrlPattern = fmt.Sprintf("/vegeta/logs?&p=%%d&job_id=%s", jobId)
-	err = G_MongoDB.C("vegeta_logs").Find(condition).Skip(pager.Offset()).Sort("-startts").Limit(pager.Limit()).All(&logs)
+	logs, err := G_Store.FindVegetaLogs(condition, pager.Offset(), pager.Limit())
 	if err != nil {
 		log.Panic(err)
 	}
 	var context = make(map[string]interface{})
 	context["logs"] = logs
 	context["jobId"] = jobId
+	if job, err := G_Store.GetVegetaJob(jobId); err == nil {
+		context["baselineId"] = job.BaselineLogId
+	}
 	context["pager"] = pager
 	RenderTemplate(r, "vegeta_logs", context)
 }
 
 func DeleteVegetaLog(req *http.Request, r render.Render) {
-	var logId = bson.ObjectIdHex(req.FormValue("log_id"))
-	err := G_MongoDB.C("vegeta_logs").RemoveId(logId)
+	var logId = req.FormValue("log_id")
+	err := G_Store.RemoveVegetaLog(logId)
+	if err != nil {
+		log.Panic(err)
+	}
+	r.Redirect(req.Referer())
+}
+
+func PinVegetaLog(req *http.Request, r render.Render) {
+	// pin log as baseline of its job
+	var logId = req.FormValue("log_id")
+	lg, err := G_Store.GetVegetaLog(logId)
+	if err != nil {
+		log.Panic(err)
+	}
+	err = PinVegetaBaseline(lg)
+	if err != nil && err != ErrJobRunning {
+		log.Panic(err)
+	}
+	r.Redirect(req.Referer())
+}
+
+func UnpinVegetaJob(req *http.Request, r render.Render) {
+	var jobId = req.FormValue("job_id")
+	err := UnpinVegetaBaseline(jobId)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -335,17 +498,31 @@ func DeleteVegetaLog(req *http.Request, r render.Render) {
 }
 
 func GetVegetaMetrics(req *http.Request, r render.Render) {
-	var lg AttackVegetaLog
-	var lgId = bson.ObjectIdHex(req.FormValue("log_id"))
-	err := G_MongoDB.C("vegeta_logs").FindId(lgId).One(&lg)
+	var lgId = req.FormValue("log_id")
+	lg, err := G_Store.GetVegetaLog(lgId)
 	if err != nil {
 		log.Panic(err)
 	}
 	var context = make(map[string]interface{})
-	context["log"] = &lg
+	context["log"] = lg
 	RenderTemplate(r, "vegeta_metrics", context)
 }
 
+func GetVegetaComparison(req *http.Request, r render.Render) {
+	req.ParseForm()
+	logs, err := LoadVegetaLogs(req.Form["log_id"])
+	if err != nil {
+		log.Panic(err)
+	}
+	comparison, err := CompareVegetaLogs(logs)
+	if err != nil {
+		log.Panic(err)
+	}
+	var context = make(map[string]interface{})
+	context["comparison"] = comparison
+	RenderTemplate(r, "compare", context)
+}
+
 type AttackVegetaLog struct {
 	Id          bson.ObjectId `json:"id"        bson:"_id,omitempty"`
 	JobId       string
@@ -355,14 +532,66 @@ type AttackVegetaLog struct {
 	Comment     string
 	State       string
 	MetricsList []*vegeta.Metrics
-	StartTs     int64
-	EndTs       int64
+	// latency distribution of each period
+	Percentiles []*LatencyPercentiles
+	// per-second statistics of the whole attack
+	Series TimeSeries
+	// qps steps actually attacked, probes of capacity search included
+	Periods []RatePeriod
+	// max sustainable qps found in search mode
+	Capacity *CapacityResult
+	// pass/fail verdict of each period and the whole attack, nil without thresholds
+	Verdicts []*Verdict
+	Verdict  *Verdict
+	// comparison against job baseline, nil without baseline
+	Regression *Regression
+	// abort rule fired, empty unless aborted
+	AbortReason string
+	// addresses of agents attacking, empty for attacks of this process
+	Agents []string
+	// results of each agent in each period
+	AgentStats []*AgentPeriodStats
+	// spread between the earliest and latest agent start of each period
+	StartSkews []time.Duration
+	StartTs    int64
+	EndTs      int64
 }
 
 func (log *AttackVegetaLog) IsRunning() bool {
 	return log.State == "Running"
 }
 
+func (log *AttackVegetaLog) MaxStartSkew() time.Duration {
+	// worst start skew between agents over all periods
+	var max time.Duration
+	for _, skew := range log.StartSkews {
+		if skew > max {
+			max = skew
+		}
+	}
+	return max
+}
+
+func (log *AttackVegetaLog) PeriodVerdict(i int) *Verdict {
+	// verdict of the i-th period, nil without thresholds
+	if i < len(log.Verdicts) {
+		return log.Verdicts[i]
+	}
+	return nil
+}
+
+func (log *AttackVegetaLog) PercentileTable() PercentileTable {
+	var table PercentileTable
+	for i, stats := range VegetaPeriodStats(log) {
+		var row = &PercentileRow{Name: fmt.Sprintf("QPS %v", stats.Step)}
+		if i < len(log.Percentiles) {
+			row.Percentiles = log.Percentiles[i]
+		}
+		table = append(table, row)
+	}
+	return table
+}
+
 func (log *AttackVegetaLog) LatencyMetrics() string {
 	var buffer bytes.Buffer
 	var startTime = 0.0
@@ -435,40 +664,162 @@ func (log *AttackVegetaLog) StatusCodesMetrics() string {
 	return buffer.String()
 }
 
-func AttackVegetaJob(job *VegetaJob, comment string) {
+func AttackVegetaJob(job *VegetaJob, log *AttackVegetaLog) {
 	// start attacking target servers
-	var log = LogAttackVegetaStart(job, comment)
 	var metricsList []*vegeta.Metrics
+	checker, err := NewResponseChecker(job.Assertions)
+	if err != nil {
+		// jobs saved before validation may hold broken assertions
+		log.State = "Aborted"
+		log.AbortReason = err.Error()
+		UpdateJobCurrentRate(job, 0)
+		LogAttackVegetaEnd(log, metricsList)
+		G_RunningVegetaJobs.Delete(job.Id.Hex())
+		G_LiveHub.Publish(job.Id.Hex(), &LiveEvent{State: log.State, LogId: log.Id.Hex()})
+		return
+	}
 	attacker := vegeta.NewAttacker(
 		vegeta.Timeout(time.Duration(job.Timeout)*time.Second),
 		vegeta.Workers(job.Workers),
 		vegeta.KeepAlive(job.Keepalive),
 		vegeta.Redirects(job.Redirects))
 	targeter := NewRandomVegetaTargeter(job)
-	for _, period := range job.Periods {
-		var metrics vegeta.Metrics
+	planner := NewVegetaPlanner(job)
+	var previous *vegeta.Metrics
+	var stopped = false
+	breaker := NewCircuitBreaker(job.AbortRules, attacker.Stop)
+	exported := G_Exporter.Job("vegeta", job.Id.Hex(), job.Name)
+	tags := NewSinkTags("vegeta", job.Id.Hex(), job.Team, job.Project, job.Hosts)
+	start := time.Now()
+	series := NewTimeSeriesCollector(start)
+	series.Run(func(stats *SecondStats) {
+		exported.SetRate(stats.Requests)
+		G_LiveHub.Publish(job.Id.Hex(), NewLiveSecondEvent(log.Id.Hex(), stats))
+		if G_MetricsSink != nil {
+			G_MetricsSink.Write(tags, start, stats)
+		}
+	})
+	var group *AgentGroup
+	if len(log.Agents) > 0 {
+		group = NewAgentGroup(log.Id.Hex(), log.Agents, start)
+		G_VegetaCancels.Put(job.Id.Hex(), group.Stop)
+	} else {
+		G_VegetaCancels.Put(job.Id.Hex(), attacker.Stop)
+	}
+	flusher := StartLogFlusher(G_LogFlushInterval, func() {
+		LogAttackVegetaSeries(log, series.Closed())
+	})
+	if G_StoppingVegetaJobs.Exists(job.Id.Hex()) {
+		// stopped before attack was cancellable
+		G_VegetaCancels.Cancel(job.Id.Hex())
+	}
+	for {
+		period, ok := planner.Next(previous)
+		if !ok {
+			break
+		}
+		var metrics = &vegeta.Metrics{}
 		var rate = period.Rate
 		var duration = time.Duration(period.Duration) * time.Second
+		var passed = 0
+		var histogram = NewHistogram()
 		UpdateJobCurrentRate(job, rate)
-		for res := range attacker.Attack(targeter, rate, duration) {
-			metrics.Add(res)
+		if group != nil {
+			var command = AgentPeriodCommand{Period: len(metricsList), Engine: "vegeta", VegetaJob: job, Rate: rate, Duration: period.Duration}
+			metrics, histogram = MergeVegetaResults(group.RunPeriod(command, job.Timeout, series))
+			exported.ObserveHistogram(histogram, int(metrics.Requests), VegetaErrorCount(metrics))
+		} else {
+			for res := range attacker.Attack(targeter, rate, duration) {
+				if checker != nil && CheckVegetaResult(checker, res) {
+					passed++
+				}
+				if breaker != nil {
+					breaker.Record(res.Timestamp.Add(res.Latency), res.Latency, res.Error != "")
+				}
+				histogram.Record(res.Latency)
+				exported.Observe(res.Latency, res.Error == "")
+				series.Record(res.Timestamp.Add(res.Latency), len(metricsList), res.Latency, int(res.Code), res.Error == "")
+				metrics.Add(res)
+			}
+			metrics.Close()
+			if checker != nil && metrics.Requests > 0 {
+				// expected statuses decide success instead of 2xx/3xx
+				metrics.Success = float64(passed) / float64(metrics.Requests)
+			}
+		}
+		metricsList = append(metricsList, metrics)
+		log.Percentiles = append(log.Percentiles, histogram.Percentiles())
+		log.Periods = append(log.Periods, period)
+		previous = metrics
+		if group != nil {
+			log.AgentStats = group.Stats()
+			log.StartSkews = group.StartSkews()
+		}
+		LogAttackVegetaPeriod(log, metricsList)
+		if breaker != nil && breaker.Reason() != "" {
+			log.AbortReason = breaker.Reason()
+			break
+		}
+		if group != nil && group.AbortReason() != "" {
+			log.AbortReason = group.AbortReason()
+			break
 		}
-		metrics.Close()
-		metricsList = append(metricsList, &metrics)
 		if G_StoppingVegetaJobs.Exists(job.Id.Hex()) {
 			G_StoppingVegetaJobs.Delete(job.Id.Hex())
+			stopped = true
 			break
 		}
 	}
-	G_RunningVegetaJobs.Delete(job.Id.Hex())
+	G_VegetaCancels.Delete(job.Id.Hex())
+	G_StoppingVegetaJobs.Delete(job.Id.Hex())
+	flusher.Stop()
+	log.Series = series.Close()
+	if group != nil {
+		group.Finish()
+		log.AgentStats = group.Stats()
+		log.StartSkews = group.StartSkews()
+	}
+	exported.SetRate(0)
+	log.State = "End"
+	if stopped {
+		log.State = "Stopped"
+	}
+	if log.AbortReason != "" {
+		log.State = "Aborted"
+	}
+	if searcher, ok := planner.(*CapacitySearcher); ok {
+		log.Capacity = searcher.Result()
+	}
 	UpdateJobCurrentRate(job, 0)
 	LogAttackVegetaEnd(log, metricsList)
+	// leave the running set only after the final state is stored
+	G_RunningVegetaJobs.Delete(job.Id.Hex())
+	G_LiveHub.Publish(job.Id.Hex(), &LiveEvent{State: log.State, LogId: log.Id.Hex()})
+}
+
+func StopVegetaAttack(jobId string) {
+	// cut current period at once, remaining periods are skipped
+	G_StoppingVegetaJobs.Put(jobId)
+	G_VegetaCancels.Cancel(jobId)
+}
+
+func CheckVegetaResult(checker *ResponseChecker, res *vegeta.Result) bool {
+	// replace vegeta's status error with assertion result, keep transport errors
+	if res.Code == 0 {
+		return false
+	}
+	res.Error = ""
+	if err := checker.CheckStatus(int(res.Code)); err != nil {
+		res.Error = err.Error()
+		return false
+	}
+	return true
 }
 
 func UpdateJobCurrentRate(job *VegetaJob, rate uint64) {
 	// realtime update job's current rate for displaying
-	var op = bson.M{"$set": bson.M{"currentrate": rate}}
-	err := G_MongoDB.C("vegeta_jobs").UpdateId(job.Id, op)
+	G_Exporter.Job("vegeta", job.Id.Hex(), job.Name).SetTarget(int64(rate))
+	err := G_Store.UpdateVegetaJob(job.Id.Hex(), bson.M{"currentrate": rate})
 	if err != nil {
 		log.Panic(err)
 	}
@@ -487,17 +838,81 @@ func LogAttackVegetaStart(job *VegetaJob, comment string) *AttackVegetaLog {
 		StartTs:   time.Now().Unix(),
 		EndTs:     0,
 	}
-	err := G_MongoDB.C("vegeta_logs").Insert(&lg)
+	if job.Distributed {
+		lg.Agents = G_Agents.LiveAddresses()
+	}
+	err := G_Store.InsertVegetaLog(&lg)
 	if err != nil {
 		log.Panic(err)
 	}
 	return &lg
 }
 
+func LogAttackVegetaPeriod(lg *AttackVegetaLog, metricsList []*vegeta.Metrics) {
+	// persist completed periods, they survive a crash of this process
+	var changed = bson.M{"metricslist": metricsList, "percentiles": lg.Percentiles, "periods": lg.Periods}
+	if len(lg.AgentStats) > 0 {
+		changed["agentstats"] = lg.AgentStats
+		changed["startskews"] = lg.StartSkews
+	}
+	err := G_Store.UpdateVegetaLog(lg.Id.Hex(), changed)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func LogAttackVegetaSeries(lg *AttackVegetaLog, series TimeSeries) {
+	// persist seconds of the running period
+	err := G_Store.UpdateVegetaLog(lg.Id.Hex(), bson.M{"series": series})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
 func LogAttackVegetaEnd(lg *AttackVegetaLog, metricsList []*vegeta.Metrics) {
 	// record attack reports after job finished
-	var op = bson.M{"$set": bson.M{"metricslist": metricsList, "state": "End", "endts": time.Now().Unix()}}
-	err := G_MongoDB.C("vegeta_logs").UpdateId(lg.Id, op)
+	var changed = bson.M{"metricslist": metricsList, "percentiles": lg.Percentiles, "series": lg.Series, "periods": lg.Periods, "state": lg.State, "endts": time.Now().Unix()}
+	if lg.AbortReason != "" {
+		changed["abortreason"] = lg.AbortReason
+	}
+	if lg.Capacity != nil {
+		changed["capacity"] = lg.Capacity
+	}
+	if len(lg.AgentStats) > 0 {
+		changed["agentstats"] = lg.AgentStats
+		changed["startskews"] = lg.StartSkews
+	}
+	// stopped and aborted runs are partial, they are neither judged nor compared
+	var finished = lg.State == "End"
+	if finished && lg.JobDetail != nil && !lg.JobDetail.Thresholds.IsEmpty() {
+		var verdicts []*Verdict
+		for _, metrics := range metricsList {
+			verdicts = append(verdicts, lg.JobDetail.Thresholds.CheckVegeta(metrics))
+		}
+		changed["verdicts"] = verdicts
+		changed["verdict"] = MergeVerdicts(verdicts)
+	}
+	var regression *Regression
+	if finished {
+		regression = EvaluateVegetaRegression(lg, metricsList)
+	}
+	if regression != nil {
+		changed["regression"] = regression
+		err := G_Store.UpdateVegetaJob(lg.JobId, bson.M{"lastregression": regression})
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	err := G_Store.UpdateVegetaLog(lg.Id.Hex(), changed)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func LogAttackVegetaInterrupted(lg *AttackVegetaLog) {
+	// keep the completed periods of a crashed attack, an unfinished run is neither judged nor compared
+	var changed = bson.M{"metricslist": lg.MetricsList, "state": "Interrupted", "endts": time.Now().Unix()}
+	err := G_Store.UpdateVegetaLog(lg.Id.Hex(), changed)
 	if err != nil {
 		log.Panic(err)
 	}